@@ -1,7 +1,6 @@
 package turf
 
 import (
-	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
 
@@ -10,16 +9,27 @@ const (
 	INDEX  = "INDEX"
 	SHOW   = "SHOW"
 	UPDATE = "UPDATE"
+	PATCH  = "PATCH"
 	DELETE = "DELETE"
+
+	// REPLACE replaces every relation of a ManyToManyController
+	REPLACE = "REPLACE"
+
+	// RESTORE restores a soft deleted model
+	RESTORE = "RESTORE"
+
+	// ATTACH attaches an existing nested model to the base model of a OneToOneController
+	ATTACH = "ATTACH"
 )
 
 type Middleware func(next http.HandlerFunc) http.HandlerFunc
 
 type Controller interface {
-	Register(r *httprouter.Router, mw Middleware)
+	Register(r Router, mw Middleware)
 	Create(http.ResponseWriter, *http.Request)
 	Index(w http.ResponseWriter, r *http.Request)
 	Show(w http.ResponseWriter, r *http.Request)
 	Update(w http.ResponseWriter, r *http.Request)
+	Patch(w http.ResponseWriter, r *http.Request)
 	Delete(w http.ResponseWriter, r *http.Request)
 }
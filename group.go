@@ -0,0 +1,77 @@
+package turf
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Group is a Router that mounts controllers under a path prefix, and wraps
+// their handlers in middleware.
+//
+//	api := turf.NewGroup(turf.HttpRouter(router), "/api/v2", middleware.Logging)
+//	api.MethodMiddleware = map[string][]turf.Middleware{
+//		turf.CREATE: {middleware.Auth},
+//		turf.UPDATE: {middleware.Auth},
+//		turf.DELETE: {middleware.Auth},
+//	}
+//	api.Register(controllers.NewPostsController())
+type Group struct {
+	// The Router the group is mounted on, which may be another Group
+	Router Router
+
+	// Prepended to the pattern of every route in the group
+	Prefix string
+
+	// Wraps every route in the group, the first Middleware being the outermost
+	Middleware []Middleware
+
+	// Wraps the routes of specific controller methods (CREATE, INDEX, etc.),
+	// inside of Middleware
+	MethodMiddleware map[string][]Middleware
+}
+
+// NewGroup creates a Group mounted on router
+func NewGroup(router Router, prefix string, middleware ...Middleware) *Group {
+	return &Group{
+		Router:     router,
+		Prefix:     prefix,
+		Middleware: middleware,
+	}
+}
+
+// Group creates a Group nested within this one
+func (g *Group) Group(prefix string, middleware ...Middleware) *Group {
+	return NewGroup(g, prefix, middleware...)
+}
+
+// Register registers each controller to the group
+func (g *Group) Register(controllers ...Controller) {
+	for _, controller := range controllers {
+		controller.Register(g, Chain())
+	}
+}
+
+func (g *Group) Handle(method string, pattern string, handler http.HandlerFunc) {
+	g.HandleMethod("", method, pattern, handler)
+}
+
+func (g *Group) HandleMethod(controllerMethod string, method string, pattern string, handler http.HandlerFunc) {
+	handler = Chain(g.MethodMiddleware[controllerMethod]...)(handler)
+	handler = Chain(g.Middleware...)(handler)
+	handle(g.Router, controllerMethod, method, strings.TrimSuffix(g.Prefix, "/")+pattern, handler)
+}
+
+func (g *Group) Param(r *http.Request, name string) string {
+	return g.Router.Param(r, name)
+}
+
+// Chain combines middleware into a single Middleware, the first being the outermost.
+// Chain() is a Middleware that does nothing.
+func Chain(middleware ...Middleware) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](next)
+		}
+		return next
+	}
+}
@@ -0,0 +1,40 @@
+package turf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGroupMiddlewareParam(t *testing.T) {
+	var middlewareId, methodMiddlewareId, handlerId string
+	mux := http.NewServeMux()
+	group := NewGroup(ServeMux(mux), "/api", func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			middlewareId = Param(r, "id")
+			next(w, r)
+		}
+	})
+	group.MethodMiddleware = map[string][]Middleware{
+		SHOW: {func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				methodMiddlewareId = Param(r, "id")
+				next(w, r)
+			}
+		}},
+	}
+	Handle(group.Group("/v2"), SHOW, http.MethodGet, "/posts/:id", func(w http.ResponseWriter, r *http.Request) {
+		handlerId = Param(r, "id")
+	})
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v2/posts/5", nil))
+	if middlewareId != "5" {
+		t.Errorf("Middleware saw id %q, expected \"5\"", middlewareId)
+	}
+	if methodMiddlewareId != "5" {
+		t.Errorf("Method middleware saw id %q, expected \"5\"", methodMiddlewareId)
+	}
+	if handlerId != "5" {
+		t.Errorf("Handler saw id %q, expected \"5\"", handlerId)
+	}
+}
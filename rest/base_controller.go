@@ -1,39 +1,58 @@
 package rest
 
 import (
+	"database/sql"
 	"net/http"
+	"time"
 
 	"github.com/go-carrot/response"
 	"github.com/go-carrot/surf"
 	"github.com/go-carrot/turf"
 	"github.com/go-carrot/validator"
-	"github.com/julienschmidt/httprouter"
 )
 
 type BaseController struct {
-	GetModel        surf.BuildModel
-	LifecycleHooks  LifecycleHooks
-	MethodWhiteList []string
+	GetModel          surf.BuildModel
+	LifecycleHooks    LifecycleHooks
+	MethodWhiteList   []string
+	FullReplace       bool
+	FilterWhiteList   []string
+	DisableFilters    bool
+	CursorPagination  bool
+	TotalCount        bool
+	Includes          []Includable
+	ModelFields       ModelFields
+	DeletePolicies    []DeletePolicy
+	Database          *sql.DB
+	SoftDelete        bool
+	CanIncludeDeleted func(r *http.Request) bool
 }
 
-func (c BaseController) Register(r *httprouter.Router, mw turf.Middleware) {
+func (c BaseController) Register(r turf.Router, mw turf.Middleware) {
 	tableName := c.GetModel().GetConfiguration().TableName
 	hasWhitelist := len(c.MethodWhiteList) != 0
+	validateDeletePolicies(tableName, c.DeletePolicies, c.Database)
 
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.CREATE) {
-		r.HandlerFunc(http.MethodPost, "/"+tableName, mw(c.Create))
+		turf.Handle(r, turf.CREATE, http.MethodPost, "/"+tableName, mw(c.Create))
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.INDEX) {
-		r.HandlerFunc(http.MethodGet, "/"+tableName, mw(c.Index))
+		turf.Handle(r, turf.INDEX, http.MethodGet, "/"+tableName, mw(c.Index))
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.SHOW) {
-		r.HandlerFunc(http.MethodGet, "/"+tableName+"/:id", mw(c.Show))
+		turf.Handle(r, turf.SHOW, http.MethodGet, "/"+tableName+"/:id", mw(c.Show))
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.UPDATE) {
-		r.HandlerFunc(http.MethodPut, "/"+tableName+"/:id", mw(c.Update))
+		turf.Handle(r, turf.UPDATE, http.MethodPut, "/"+tableName+"/:id", mw(c.Update))
+	}
+	if !hasWhitelist || contains(c.MethodWhiteList, turf.PATCH) {
+		turf.Handle(r, turf.PATCH, http.MethodPatch, "/"+tableName+"/:id", mw(c.Patch))
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.DELETE) {
-		r.HandlerFunc(http.MethodDelete, "/"+tableName+"/:id", mw(c.Delete))
+		turf.Handle(r, turf.DELETE, http.MethodDelete, "/"+tableName+"/:id", mw(c.Delete))
+	}
+	if c.SoftDelete && (!hasWhitelist || contains(c.MethodWhiteList, turf.RESTORE)) {
+		turf.Handle(r, turf.RESTORE, http.MethodPost, "/"+tableName+"/:id/restore", mw(c.Restore))
 	}
 }
 
@@ -45,8 +64,13 @@ func (c BaseController) Create(w http.ResponseWriter, r *http.Request) {
 	model := c.GetModel()
 
 	// Generate + test values
-	values := getInsertValues(r, model)
-	err := validator.Validate(values)
+	values, err := getInsertValues(r, model)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(bodyErrorStatus(err), nil)
+		return
+	}
+	err = validator.Validate(values)
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
 		resp.SetResult(http.StatusBadRequest, nil)
@@ -88,11 +112,15 @@ func (c BaseController) Index(w http.ResponseWriter, r *http.Request) {
 	bulkFetchConfig := surf.BulkFetchConfig{}
 
 	// Validate
-	var sort string
+	var sort, fields, include string
+	var includeDeleted bool
 	err := validator.Validate([]*validator.Value{
 		defaultLimitValue(&bulkFetchConfig.Limit, r),
 		defaultOffsetValue(&bulkFetchConfig.Offset, r),
-		defaultSortValue(&sort, c.GetModel().GetConfiguration(), r),
+		defaultSortValue(&sort, c.GetModel().GetConfiguration(), c.ModelFields, r),
+		fieldsValue(&fields, c.GetModel().GetConfiguration().TableName, c.GetModel(), r),
+		includeValue(&include, c.Includes, r),
+		includeDeletedValue(&includeDeleted, c.CanIncludeDeleted, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -100,11 +128,38 @@ func (c BaseController) Index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	includes := requestedIncludes(include, c.Includes)
+
+	// Parse cursor
+	var requestCursor *cursor
+	if c.CursorPagination {
+		requestCursor, err = parseCursor(r, c.GetModel().GetConfiguration(), c.ModelFields.idField(), sort)
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusBadRequest, nil)
+			return
+		}
+	}
+
 	// Consume sort query
 	bulkFetchConfig.ConsumeSortQuery(sort)
 
+	// Consume filter query
+	filterPredicates, err := getFilterPredicates(r, c.GetModel(), c.FilterWhiteList, c.DisableFilters)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusBadRequest, nil)
+		return
+	}
+	bulkFetchConfig.Predicates = append(bulkFetchConfig.Predicates, filterPredicates...)
+
+	// Exclude soft deleted models
+	if c.SoftDelete && !includeDeleted {
+		bulkFetchConfig.Predicates = append(bulkFetchConfig.Predicates, notDeletedPredicate(c.ModelFields))
+	}
+
 	// Consume If-Modified-Since header
-	applyModSinceHeader(&bulkFetchConfig, r)
+	applyModSinceHeader(&bulkFetchConfig, c.ModelFields, r)
 
 	// Before Index hook
 	if c.LifecycleHooks.BeforeIndex != nil {
@@ -115,13 +170,37 @@ func (c BaseController) Index(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Load models
-	models, err := c.GetModel().BulkFetch(bulkFetchConfig, c.GetModel)
+	var models []surf.Model
+	buildModel := selectingModel(c.GetModel, c.ModelFields.idField(), splitFields(fields), bulkFetchConfig, append(includeFields(includes), c.ModelFields.modifiedAtField())...)
+	if c.CursorPagination {
+		models, err = fetchCursorPage(w, r, buildModel, c.ModelFields.idField(), bulkFetchConfig, requestCursor, sort)
+	} else {
+		models, err = buildModel().BulkFetch(bulkFetchConfig, buildModel)
+	}
 	if err != nil {
 		resp.SetResult(http.StatusBadRequest, nil)
 		resp.SetErrorDetails(err.Error())
 		return
 	}
 
+	// Set Last-Modified header
+	setLastModifiedHeader(w, c.ModelFields, models...)
+
+	// Set pagination headers
+	total := int64(-1)
+	if c.TotalCount {
+		total, err = countModels(c.GetModel(), bulkFetchConfig, c.Database)
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusInternalServerError, nil)
+			return
+		}
+		setTotalCountHeader(w, total)
+	}
+	if !c.CursorPagination {
+		setOffsetLinkHeader(w, r, bulkFetchConfig, sort, len(models), total)
+	}
+
 	// After Index hook
 	if c.LifecycleHooks.AfterIndex != nil {
 		err := c.LifecycleHooks.AfterIndex(resp, r, &models)
@@ -130,8 +209,24 @@ func (c BaseController) Index(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Select fields
+	output, err := sparseModels(models, splitFields(fields))
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Embed includes
+	output, err = embedIncludes(models, output, splitFields(fields), includes)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
 	// OK
-	resp.SetResult(http.StatusOK, models)
+	resp.SetResult(http.StatusOK, output)
 }
 
 func (c BaseController) Show(w http.ResponseWriter, r *http.Request) {
@@ -139,9 +234,14 @@ func (c BaseController) Show(w http.ResponseWriter, r *http.Request) {
 	defer resp.Output()
 
 	// Validate Params
-	var id int64
+	model := c.GetModel()
+	var fields, include string
+	var includeDeleted bool
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
+		baseModelIdValue(model, c.ModelFields, r),
+		fieldsValue(&fields, c.GetModel().GetConfiguration().TableName, c.GetModel(), r),
+		includeValue(&include, c.Includes, r),
+		includeDeletedValue(&includeDeleted, c.CanIncludeDeleted, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -149,16 +249,6 @@ func (c BaseController) Show(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set ID
-	model := c.GetModel()
-	configuration := model.GetConfiguration()
-	for _, field := range configuration.Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
-		}
-	}
-
 	// Before Show hook
 	if c.LifecycleHooks.BeforeShow != nil {
 		err := c.LifecycleHooks.BeforeShow(resp, r, model)
@@ -168,7 +258,7 @@ func (c BaseController) Show(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Load
-	err = model.Load()
+	err = loadModel(r, model, c.ModelFields, c.SoftDelete && !includeDeleted)
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
@@ -182,11 +272,63 @@ func (c BaseController) Show(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Check `If-None-Match` header
+	etag, err := modelETag(model, c.ModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if !isNoneMatchHeader(etag, r) {
+		resp.SetResult(http.StatusNotModified, nil)
+		return
+	}
+
+	// Check `If-Modified-Since` header
+	setLastModifiedHeader(w, c.ModelFields, model)
+	if !isModifiedSinceHeader(model, c.ModelFields, r) {
+		resp.SetResult(http.StatusNotModified, nil)
+		return
+	}
+
+	// Select fields
+	output, err := sparseModel(model, splitFields(fields))
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Embed includes
+	output, err = embedModelIncludes(model, output, splitFields(fields), requestedIncludes(include, c.Includes))
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
 	// OK
-	resp.SetResult(http.StatusOK, model)
+	resp.SetResult(http.StatusOK, output)
 }
 
 func (c BaseController) Update(w http.ResponseWriter, r *http.Request) {
+	if c.FullReplace {
+		c.update(w, r, getReplaceValues)
+	} else {
+		c.update(w, r, getUpdateValues)
+	}
+}
+
+func (c BaseController) Patch(w http.ResponseWriter, r *http.Request) {
+	if !isPatchRequest(r) {
+		writeUnsupportedPatchType(w)
+		return
+	}
+	c.update(w, r, getPatchValues)
+}
+
+func (c BaseController) update(w http.ResponseWriter, r *http.Request, getValues valuesGenerator) {
 	resp := response.New(w)
 	defer resp.Output()
 
@@ -194,9 +336,8 @@ func (c BaseController) Update(w http.ResponseWriter, r *http.Request) {
 	model := c.GetModel()
 
 	// Validate ID
-	var id int64
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
+		baseModelIdValue(model, c.ModelFields, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -204,31 +345,49 @@ func (c BaseController) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set ID
-	configuration := model.GetConfiguration()
-	for _, field := range configuration.Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
-		}
+	// Begin transaction
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
+	defer rollbackTx(r)
 
-	// Load
-	err = model.Load()
+	// Load, locking the model so the `If-Match` condition holds until it is updated
+	err = loadModel(r, model, c.ModelFields, c.SoftDelete)
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
 
 	// Check `If-Unmodified-Since` header
-	if !isUnmodifiedSinceHeader(model, r) {
+	if !isUnmodifiedSinceHeader(model, c.ModelFields, r) {
 		resp.SetErrorDetails("The `If-Unmodified-Since` condition is not satisfied")
 		resp.SetResult(http.StatusPreconditionFailed, nil)
 		return
 	}
 
+	// Check `If-Match` and `If-None-Match` headers
+	etag, err := modelETag(model, c.ModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if !isMatchHeader(etag, r) || !isNoneMatchHeader(etag, r) {
+		resp.SetErrorDetails("The `If-Match` or `If-None-Match` condition is not satisfied")
+		resp.SetResult(http.StatusPreconditionFailed, nil)
+		return
+	}
+
 	// Generate + test values
-	values := getUpdateValues(r, model)
+	values, err := getValues(r, model)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(bodyErrorStatus(err), nil)
+		return
+	}
 	err = validator.Validate(values)
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -245,7 +404,7 @@ func (c BaseController) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update
-	err = model.Update()
+	err = updateModel(r, model, c.ModelFields)
 	if err != nil {
 		handleInsertUpdateError(resp, err)
 		return
@@ -259,6 +418,23 @@ func (c BaseController) Update(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Commit
+	err = commitTx(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Set ETag header
+	etag, err = modelETag(model, c.ModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	w.Header().Set("ETag", etag)
+
 	// OK
 	resp.SetResult(http.StatusOK, model)
 }
@@ -268,9 +444,9 @@ func (c BaseController) Delete(w http.ResponseWriter, r *http.Request) {
 	defer resp.Output()
 
 	// Validate Params
-	var id int64
+	model := c.GetModel()
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
+		baseModelIdValue(model, c.ModelFields, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -278,14 +454,33 @@ func (c BaseController) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set ID
-	model := c.GetModel()
-	configuration := model.GetConfiguration()
-	for _, field := range configuration.Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
-		}
+	// Begin transaction
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	defer rollbackTx(r)
+
+	// Load
+	err = loadModel(r, model, c.ModelFields, c.SoftDelete)
+	if err != nil {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Check `If-Match` and `If-None-Match` headers
+	etag, err := modelETag(model, c.ModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if !isMatchHeader(etag, r) || !isNoneMatchHeader(etag, r) {
+		resp.SetErrorDetails("The `If-Match` or `If-None-Match` condition is not satisfied")
+		resp.SetResult(http.StatusPreconditionFailed, nil)
+		return
 	}
 
 	// Before Delete hook
@@ -296,10 +491,25 @@ func (c BaseController) Delete(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Apply delete policies
+	var deletedAt time.Time
+	if c.SoftDelete {
+		deletedAt = time.Now()
+	}
+	err = applyDeletePolicies(r, model, c.ModelFields.idField(), c.DeletePolicies, deletedAt)
+	if err != nil {
+		handleDeleteError(resp, err)
+		return
+	}
+
 	// Delete
-	err = model.Delete()
+	if c.SoftDelete {
+		err = softDeleteModel(r, model, c.ModelFields, deletedAt)
+	} else {
+		err = deleteModel(r, model, c.ModelFields)
+	}
 	if err != nil {
-		resp.SetResult(http.StatusNotFound, nil)
+		handleDeleteError(resp, err)
 		return
 	}
 
@@ -311,6 +521,87 @@ func (c BaseController) Delete(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Commit
+	err = commitTx(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
 	// OK
 	resp.SetResult(http.StatusOK, nil)
 }
+
+func (c BaseController) Restore(w http.ResponseWriter, r *http.Request) {
+	resp := response.New(w)
+	defer resp.Output()
+
+	// Validate Params
+	model := c.GetModel()
+	err := validator.Validate([]*validator.Value{
+		baseModelIdValue(model, c.ModelFields, r),
+	})
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusBadRequest, nil)
+		return
+	}
+
+	// Begin transaction
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	defer rollbackTx(r)
+
+	// Load
+	err = loadModel(r, model, c.ModelFields, false)
+	if err != nil {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Before Restore hook
+	if c.LifecycleHooks.BeforeRestore != nil {
+		err := c.LifecycleHooks.BeforeRestore(resp, r, model)
+		if err != nil {
+			return
+		}
+	}
+
+	// Restore the children deleted along with the model
+	err = restoreDeletePolicies(r, model, c.ModelFields.idField(), c.DeletePolicies, modelDeletedAt(model, c.ModelFields))
+	if err != nil {
+		handleInsertUpdateError(resp, err)
+		return
+	}
+
+	// Restore
+	err = restoreModel(r, model, c.ModelFields)
+	if err != nil {
+		handleInsertUpdateError(resp, err)
+		return
+	}
+
+	// After Restore hook
+	if c.LifecycleHooks.AfterRestore != nil {
+		err := c.LifecycleHooks.AfterRestore(resp, r, model)
+		if err != nil {
+			return
+		}
+	}
+
+	// Commit
+	err = commitTx(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// OK
+	resp.SetResult(http.StatusOK, model)
+}
@@ -0,0 +1,290 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-carrot/surf"
+)
+
+// cursor is a position between two rows of an index, used for keyset pagination.
+//
+// The position is directly after the row whose sort fields have the values `Values`,
+// or directly before it when `Backward` is set.  The values follow the order of the
+// sort, with the id last, so they identify a single row and the position is stable
+// when rows are inserted or deleted anywhere else in the index.  With `Inclusive`
+// set, the row itself is on the side of the position being loaded.
+type cursor struct {
+	Sort      string            `json:"s"`
+	Values    []json.RawMessage `json:"v"`
+	Inclusive bool              `json:"i,omitempty"`
+	Backward  bool              `json:"b,omitempty"`
+}
+
+func (c cursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// parseCursor reads the `cursor` parameter of a request.  A cursor may only be
+// used with the sort it was issued for.
+//
+// Every field of the sort must be non-nullable, as rows can't be seeked past a null.
+func parseCursor(r *http.Request, config *surf.Configuration, idField string, sort string) (*cursor, error) {
+	// Make sure the sort can be seeked
+	fields := cursorFields(sort, idField)
+	for _, field := range config.Fields {
+		if contains(fields, field.Name) && isNullableField(field) {
+			return nil, fmt.Errorf("Parameter 'sort' can't contain the nullable field '%v' when paging with cursors.", field.Name)
+		}
+	}
+
+	input := r.URL.Query().Get("cursor")
+	if input == "" {
+		return nil, nil
+	}
+
+	// Decode
+	var c cursor
+	raw, err := base64.RawURLEncoding.DecodeString(input)
+	if err == nil {
+		err = json.Unmarshal(raw, &c)
+	}
+	if err != nil {
+		return nil, errors.New("Parameter 'cursor' is invalid.")
+	}
+
+	// Make sure the sort hasn't changed
+	if c.Sort != sort {
+		return nil, errors.New("Parameter 'cursor' was issued for a different sort. Input '" + sort + "' is invalid.")
+	}
+
+	// Make sure there is a value for each field
+	if len(c.Values) != len(fields) {
+		return nil, errors.New("Parameter 'cursor' is invalid.")
+	}
+	for _, value := range c.Values {
+		if len(value) == 0 || bytes.Equal(value, []byte("null")) {
+			return nil, errors.New("Parameter 'cursor' is invalid.")
+		}
+	}
+	return &c, nil
+}
+
+// cursorFields returns the fields a cursor for sort has values for: the sort fields,
+// followed by idField if the sort doesn't contain it
+func cursorFields(sort string, idField string) []string {
+	var fields []string
+	for _, field := range strings.Split(sort, ",") {
+		if field = strings.TrimPrefix(field, "-"); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	if !contains(fields, idField) {
+		fields = append(fields, idField)
+	}
+	return fields
+}
+
+// fetchCursorPage loads a page of models from the position of requestCursor (or the
+// first page, if requestCursor is nil), and sets the `X-Next-Cursor` and `X-Prev-Cursor`
+// headers along with the `Link` header.  The Offset of bulkFetchConfig is ignored.
+//
+// Ties are ordered by idField, so every row has a unique position.
+func fetchCursorPage(w http.ResponseWriter, r *http.Request, buildModel surf.BuildModel, idField string, bulkFetchConfig surf.BulkFetchConfig, requestCursor *cursor, sort string) ([]surf.Model, error) {
+	// Order ties by id
+	orderBys := append([]surf.OrderBy{}, bulkFetchConfig.OrderBys...)
+	hasId := false
+	for _, orderBy := range orderBys {
+		if orderBy.Field == idField {
+			hasId = true
+		}
+	}
+	if !hasId {
+		orderBys = append(orderBys, surf.OrderBy{Field: idField, Type: surf.ORDER_BY_ASC})
+	}
+	bulkFetchConfig.OrderBys = orderBys
+	bulkFetchConfig.Offset = 0
+	pager := keysetPager{
+		BuildModel:      buildModel,
+		BulkFetchConfig: bulkFetchConfig,
+	}
+	if requestCursor != nil && len(requestCursor.Values) != len(orderBys) {
+		return nil, errors.New("Parameter 'cursor' is invalid.")
+	}
+
+	// Load the page
+	limit := bulkFetchConfig.Limit
+	var models []surf.Model
+	var next, prev *cursor
+	var err error
+	switch {
+	case requestCursor == nil:
+		models, err = pager.fetch(nil, orderBys, limit)
+		if err == nil && len(models) == limit {
+			next = pager.cursorAt(models[len(models)-1], false)
+		}
+	case !requestCursor.Backward:
+		models, err = pager.seek(requestCursor.Values, true, requestCursor.Inclusive)
+		if err == nil && len(models) == limit {
+			next = pager.cursorAt(models[len(models)-1], false)
+		}
+		if len(models) > 0 {
+			prev = pager.cursorAt(models[0], true)
+		} else {
+			prev = &cursor{Values: requestCursor.Values, Inclusive: !requestCursor.Inclusive, Backward: true}
+		}
+	default:
+		models, err = pager.seek(requestCursor.Values, false, requestCursor.Inclusive)
+		if err == nil && len(models) == limit {
+			prev = pager.cursorAt(models[0], true)
+		}
+		if len(models) > 0 {
+			next = pager.cursorAt(models[len(models)-1], false)
+		} else {
+			next = &cursor{Values: requestCursor.Values, Inclusive: !requestCursor.Inclusive}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Set headers
+	if next != nil {
+		next.Sort = sort
+		w.Header().Set("X-Next-Cursor", next.encode())
+	}
+	if prev != nil {
+		prev.Sort = sort
+		w.Header().Set("X-Prev-Cursor", prev.encode())
+	}
+	setCursorLinkHeader(w, r, bulkFetchConfig, sort, next, prev)
+	return models, nil
+}
+
+// keysetPager loads the rows on either side of a cursor
+type keysetPager struct {
+	BuildModel      surf.BuildModel
+	BulkFetchConfig surf.BulkFetchConfig
+}
+
+// seek loads a page of rows directly after (or before) the row with values.
+//
+// Predicates can only be combined with AND, so the rows are loaded one sort field at
+// a time, starting from the last: first the rows sharing every value but the last one,
+// that come after it on the last field, then the rows sharing every value but the last
+// two, that come after it on the second to last field, and so on until the page is full.
+// Every query seeks directly to its rows, so no rows are skipped with an offset.
+func (p keysetPager) seek(values []json.RawMessage, after bool, inclusive bool) ([]surf.Model, error) {
+	orderBys := p.BulkFetchConfig.OrderBys
+	if !after {
+		orderBys = reverseOrderBys(orderBys)
+	}
+	limit := p.BulkFetchConfig.Limit
+
+	var models []surf.Model
+	for i := len(values) - 1; i >= 0 && len(models) < limit; i-- {
+		var predicates []surf.Predicate
+		for j := 0; j < i; j++ {
+			predicates = append(predicates, surf.Predicate{
+				Field:         orderBys[j].Field,
+				PredicateType: surf.WHERE_EQUAL,
+				Values:        []interface{}{cursorPredicateValue(values[j])},
+			})
+		}
+		predicates = append(predicates, seekPredicate(orderBys[i], values[i], inclusive && i == len(values)-1))
+		rows, err := p.fetch(predicates, orderBys, limit-len(models))
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, rows...)
+	}
+
+	if !after {
+		return reverseModels(models), nil
+	}
+	return models, nil
+}
+
+func (p keysetPager) fetch(predicates []surf.Predicate, orderBys []surf.OrderBy, limit int) ([]surf.Model, error) {
+	bulkFetchConfig := p.BulkFetchConfig
+	bulkFetchConfig.Predicates = append(append([]surf.Predicate{}, bulkFetchConfig.Predicates...), predicates...)
+	bulkFetchConfig.OrderBys = orderBys
+	bulkFetchConfig.Offset = 0
+	bulkFetchConfig.Limit = limit
+	return p.BuildModel().BulkFetch(bulkFetchConfig, p.BuildModel)
+}
+
+// cursorAt returns the cursor directly after (or before, if backward is set) a model
+func (p keysetPager) cursorAt(model surf.Model, backward bool) *cursor {
+	values := make([]json.RawMessage, len(p.BulkFetchConfig.OrderBys))
+	for i, orderBy := range p.BulkFetchConfig.OrderBys {
+		values[i] = fieldJSONValue(model, orderBy.Field)
+	}
+	return &cursor{Values: values, Backward: backward}
+}
+
+// seekPredicate matches the rows that come after value in the order of orderBy
+func seekPredicate(orderBy surf.OrderBy, value json.RawMessage, inclusive bool) surf.Predicate {
+	greater := orderBy.Type != surf.ORDER_BY_DESC
+	predicate := surf.Predicate{
+		Field:  orderBy.Field,
+		Values: []interface{}{cursorPredicateValue(value)},
+	}
+	switch {
+	case greater && inclusive:
+		predicate.PredicateType = surf.WHERE_GREATER_THAN_OR_EQUAL_TO
+	case greater:
+		predicate.PredicateType = surf.WHERE_GREATER_THAN
+	case inclusive:
+		predicate.PredicateType = surf.WHERE_LESS_THAN_OR_EQUAL_TO
+	default:
+		predicate.PredicateType = surf.WHERE_LESS_THAN
+	}
+	return predicate
+}
+
+// fieldJSONValue returns the JSON representation of a field of a model
+func fieldJSONValue(model surf.Model, name string) json.RawMessage {
+	for _, field := range model.GetConfiguration().Fields {
+		if field.Name == name {
+			value, _ := json.Marshal(field.Pointer)
+			return value
+		}
+	}
+	return json.RawMessage("null")
+}
+
+// cursorPredicateValue converts the JSON value of a cursor back into a predicate value
+func cursorPredicateValue(raw json.RawMessage) interface{} {
+	value, _ := decodeJSONValue(raw)
+	if number, isNumber := value.(json.Number); isNumber {
+		return number.String()
+	}
+	return value
+}
+
+func reverseOrderBys(orderBys []surf.OrderBy) []surf.OrderBy {
+	reversed := make([]surf.OrderBy, len(orderBys))
+	for i, orderBy := range orderBys {
+		reversed[i] = orderBy
+		if orderBy.Type == surf.ORDER_BY_DESC {
+			reversed[i].Type = surf.ORDER_BY_ASC
+		} else {
+			reversed[i].Type = surf.ORDER_BY_DESC
+		}
+	}
+	return reversed
+}
+
+func reverseModels(models []surf.Model) []surf.Model {
+	for i, j := 0, len(models)-1; i < j; i, j = i+1, j-1 {
+		models[i], models[j] = models[j], models[i]
+	}
+	return models
+}
@@ -0,0 +1,422 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-carrot/surf"
+	"github.com/guregu/null"
+)
+
+// testPost is an in-memory model, whose BulkFetch applies the predicates, order,
+// limit and offset of a BulkFetchConfig to testPosts
+type testPost struct {
+	Id    int64  `json:"id"`
+	Rank  int64  `json:"rank"`
+	Title string `json:"title"`
+}
+
+var testPosts []testPost
+
+func newTestPost() surf.Model {
+	return &testPost{}
+}
+
+func (p *testPost) GetConfiguration() *surf.Configuration {
+	return &surf.Configuration{
+		TableName: "posts",
+		Fields: []surf.Field{
+			{Pointer: &p.Id, Name: "id", UniqueIdentifier: true},
+			{Pointer: &p.Rank, Name: "rank"},
+			{Pointer: &p.Title, Name: "title"},
+		},
+	}
+}
+
+func (p *testPost) Insert() error { return nil }
+func (p *testPost) Load() error   { return nil }
+func (p *testPost) Update() error { return nil }
+func (p *testPost) Delete() error { return nil }
+
+func (p *testPost) BulkFetch(bulkFetchConfig surf.BulkFetchConfig, buildModel surf.BuildModel) ([]surf.Model, error) {
+	var rows []testPost
+	for _, row := range testPosts {
+		if row.matches(bulkFetchConfig.Predicates) {
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, orderBy := range bulkFetchConfig.OrderBys {
+			comparison := rows[i].compare(orderBy.Field, rows[j].value(orderBy.Field))
+			if comparison != 0 {
+				return (comparison < 0) == (orderBy.Type == surf.ORDER_BY_ASC)
+			}
+		}
+		return false
+	})
+	if bulkFetchConfig.Offset < len(rows) {
+		rows = rows[bulkFetchConfig.Offset:]
+	} else {
+		rows = nil
+	}
+	if len(rows) > bulkFetchConfig.Limit {
+		rows = rows[:bulkFetchConfig.Limit]
+	}
+	models := []surf.Model{}
+	for _, row := range rows {
+		model := buildModel().(*testPost)
+		*model = row
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+func (p testPost) value(field string) interface{} {
+	switch field {
+	case "id":
+		return p.Id
+	case "rank":
+		return p.Rank
+	}
+	return p.Title
+}
+
+// compare compares a field of the post with a predicate value, which numbers
+// are passed as strings in
+func (p testPost) compare(field string, value interface{}) int {
+	switch current := p.value(field).(type) {
+	case int64:
+		other, _ := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+		switch {
+		case current < other:
+			return -1
+		case current > other:
+			return 1
+		}
+		return 0
+	default:
+		return strings.Compare(fmt.Sprint(current), fmt.Sprint(value))
+	}
+}
+
+func (p testPost) matches(predicates []surf.Predicate) bool {
+	for _, predicate := range predicates {
+		comparison := p.compare(predicate.Field, predicate.Values[0])
+		var matches bool
+		switch predicate.PredicateType {
+		case surf.WHERE_EQUAL:
+			matches = comparison == 0
+		case surf.WHERE_GREATER_THAN:
+			matches = comparison > 0
+		case surf.WHERE_GREATER_THAN_OR_EQUAL_TO:
+			matches = comparison >= 0
+		case surf.WHERE_LESS_THAN:
+			matches = comparison < 0
+		case surf.WHERE_LESS_THAN_OR_EQUAL_TO:
+			matches = comparison <= 0
+		}
+		if !matches {
+			return false
+		}
+	}
+	return true
+}
+
+func testPostIds(models []surf.Model) []int64 {
+	ids := []int64{}
+	for _, model := range models {
+		ids = append(ids, model.(*testPost).Id)
+	}
+	return ids
+}
+
+func TestCursorFields(t *testing.T) {
+	tests := []struct {
+		sort   string
+		fields []string
+	}{
+		{"", []string{"id"}},
+		{"id", []string{"id"}},
+		{"-id", []string{"id"}},
+		{"-rank", []string{"rank", "id"}},
+		{"-rank,title", []string{"rank", "title", "id"}},
+		{"title,-id,rank", []string{"title", "id", "rank"}},
+	}
+
+	for _, test := range tests {
+		fields := cursorFields(test.sort, "id")
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("Sort %q gave fields %v, expected %v", test.sort, fields, test.fields)
+		}
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	valid := cursor{
+		Sort:   "-rank",
+		Values: []json.RawMessage{json.RawMessage(`3`), json.RawMessage(`7`)},
+	}
+	null := cursor{
+		Sort:   "-rank",
+		Values: []json.RawMessage{json.RawMessage(`null`), json.RawMessage(`7`)},
+	}
+	short := cursor{
+		Sort:   "-rank",
+		Values: []json.RawMessage{json.RawMessage(`7`)},
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   string
+		parsed *cursor
+		fails  bool
+	}{
+		{name: "no cursor", sort: "-rank"},
+		{name: "valid cursor", cursor: valid.encode(), sort: "-rank", parsed: &valid},
+		{name: "different sort", cursor: valid.encode(), sort: "rank", fails: true},
+		{name: "null value", cursor: null.encode(), sort: "-rank", fails: true},
+		{name: "missing value", cursor: short.encode(), sort: "-rank", fails: true},
+		{name: "not base64", cursor: "!!!", sort: "-rank", fails: true},
+		{name: "not JSON", cursor: "bm90IGpzb24", sort: "-rank", fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/posts?cursor="+url.QueryEscape(test.cursor), nil)
+			parsed, err := parseCursor(r, newTestPost().GetConfiguration(), "id", test.sort)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("Expected an error, got %+v", parsed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(parsed, test.parsed) {
+				t.Errorf("Parsed %+v, expected %+v", parsed, test.parsed)
+			}
+		})
+	}
+}
+
+func TestParseCursorNullableSort(t *testing.T) {
+	var id int64
+	var publishedAt null.Time
+	config := &surf.Configuration{
+		TableName: "posts",
+		Fields: []surf.Field{
+			{Pointer: &id, Name: "id"},
+			{Pointer: &publishedAt, Name: "published_at"},
+		},
+	}
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	_, err := parseCursor(r, config, "id", "-published_at")
+	if err == nil {
+		t.Error("Expected sorting by a nullable field to be rejected")
+	}
+	_, err = parseCursor(r, config, "id", "-id")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSeekPredicate(t *testing.T) {
+	tests := []struct {
+		orderByType   surf.OrderByType
+		inclusive     bool
+		predicateType surf.PredicateType
+	}{
+		{surf.ORDER_BY_ASC, false, surf.WHERE_GREATER_THAN},
+		{surf.ORDER_BY_ASC, true, surf.WHERE_GREATER_THAN_OR_EQUAL_TO},
+		{surf.ORDER_BY_DESC, false, surf.WHERE_LESS_THAN},
+		{surf.ORDER_BY_DESC, true, surf.WHERE_LESS_THAN_OR_EQUAL_TO},
+	}
+
+	for _, test := range tests {
+		predicate := seekPredicate(surf.OrderBy{Field: "rank", Type: test.orderByType}, json.RawMessage(`5`), test.inclusive)
+		expected := surf.Predicate{Field: "rank", PredicateType: test.predicateType, Values: []interface{}{"5"}}
+		if !reflect.DeepEqual(predicate, expected) {
+			t.Errorf("Order %v (inclusive: %v) gave %+v, expected %+v", test.orderByType, test.inclusive, predicate, expected)
+		}
+	}
+}
+
+func TestCursorPredicateValue(t *testing.T) {
+	tests := []struct {
+		raw   string
+		value interface{}
+	}{
+		{`5`, "5"},
+		{`12345678901234567890`, "12345678901234567890"},
+		{`1.5`, "1.5"},
+		{`"title"`, "title"},
+		{`true`, true},
+	}
+
+	for _, test := range tests {
+		value := cursorPredicateValue(json.RawMessage(test.raw))
+		if !reflect.DeepEqual(value, test.value) {
+			t.Errorf("%v gave %#v, expected %#v", test.raw, value, test.value)
+		}
+	}
+}
+
+func TestCursorAt(t *testing.T) {
+	pager := keysetPager{
+		BuildModel: newTestPost,
+		BulkFetchConfig: surf.BulkFetchConfig{
+			OrderBys: []surf.OrderBy{
+				{Field: "rank", Type: surf.ORDER_BY_DESC},
+				{Field: "title", Type: surf.ORDER_BY_ASC},
+				{Field: "id", Type: surf.ORDER_BY_ASC},
+			},
+		},
+	}
+
+	c := pager.cursorAt(&testPost{Id: 4, Rank: 2, Title: "b"}, true)
+	expected := &cursor{
+		Values:   []json.RawMessage{json.RawMessage(`2`), json.RawMessage(`"b"`), json.RawMessage(`4`)},
+		Backward: true,
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("Cursor is %+v, expected %+v", c, expected)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	testPosts = []testPost{
+		{Id: 1, Rank: 2, Title: "b"},
+		{Id: 2, Rank: 1, Title: "a"},
+		{Id: 3, Rank: 2, Title: "a"},
+		{Id: 4, Rank: 2, Title: "b"},
+		{Id: 5, Rank: 3, Title: "c"},
+		{Id: 6, Rank: 2, Title: "a"},
+		{Id: 7, Rank: 1, Title: "b"},
+	}
+	// Ordered by -rank,title,id: 5, 3, 6, 1, 4, 2, 7
+	pager := keysetPager{
+		BuildModel: newTestPost,
+		BulkFetchConfig: surf.BulkFetchConfig{
+			Limit: 3,
+			OrderBys: []surf.OrderBy{
+				{Field: "rank", Type: surf.ORDER_BY_DESC},
+				{Field: "title", Type: surf.ORDER_BY_ASC},
+				{Field: "id", Type: surf.ORDER_BY_ASC},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		at        testPost
+		after     bool
+		inclusive bool
+		ids       []int64
+	}{
+		{name: "after the first row", at: testPosts[4], after: true, ids: []int64{3, 6, 1}},
+		{name: "after a tie on every field but the id", at: testPosts[2], after: true, ids: []int64{6, 1, 4}},
+		{name: "after a tie on the first field", at: testPosts[5], after: true, ids: []int64{1, 4, 2}},
+		{name: "after the last rows", at: testPosts[1], after: true, ids: []int64{7}},
+		{name: "after the last row", at: testPosts[6], after: true, ids: []int64{}},
+		{name: "inclusive after", at: testPosts[0], after: true, inclusive: true, ids: []int64{1, 4, 2}},
+		{name: "before a tie on the first field", at: testPosts[3], ids: []int64{3, 6, 1}},
+		{name: "before the second row", at: testPosts[2], ids: []int64{5}},
+		{name: "before the first row", at: testPosts[4], ids: []int64{}},
+		{name: "inclusive before", at: testPosts[1], inclusive: true, ids: []int64{1, 4, 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			at := test.at
+			models, err := pager.seek(pager.cursorAt(&at, !test.after).Values, test.after, test.inclusive)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			ids := testPostIds(models)
+			if !reflect.DeepEqual(ids, test.ids) {
+				t.Errorf("Loaded %v, expected %v", ids, test.ids)
+			}
+		})
+	}
+}
+
+func TestFetchCursorPage(t *testing.T) {
+	testPosts = nil
+	for i := int64(1); i <= 9; i++ {
+		testPosts = append(testPosts, testPost{Id: i, Rank: i % 3, Title: string(rune('a' + i%2))})
+	}
+	// Ordered by -rank,title,id: 2, 8, 5, 4, 1, 7, 6, 3, 9
+	bulkFetchConfig := surf.BulkFetchConfig{
+		Limit: 3,
+		OrderBys: []surf.OrderBy{
+			{Field: "rank", Type: surf.ORDER_BY_DESC},
+			{Field: "title", Type: surf.ORDER_BY_ASC},
+		},
+	}
+	fetchPage := func(input string) ([]int64, string, string) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/posts?sort=-rank,title&cursor="+url.QueryEscape(input), nil)
+		requestCursor, err := parseCursor(r, newTestPost().GetConfiguration(), "id", "-rank,title")
+		if err != nil {
+			t.Fatalf("Unexpected error parsing cursor: %v", err)
+		}
+		w := httptest.NewRecorder()
+		models, err := fetchCursorPage(w, r, newTestPost, "id", bulkFetchConfig, requestCursor, "-rank,title")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return testPostIds(models), w.Header().Get("X-Next-Cursor"), w.Header().Get("X-Prev-Cursor")
+	}
+
+	// Each page is loaded with the next or previous cursor of an earlier page
+	tests := []struct {
+		name    string
+		from    string
+		prev    bool
+		ids     []int64
+		hasNext bool
+		hasPrev bool
+	}{
+		{name: "first", ids: []int64{2, 8, 5}, hasNext: true},
+		{name: "second", from: "first", ids: []int64{4, 1, 7}, hasNext: true, hasPrev: true},
+		{name: "third", from: "second", ids: []int64{6, 3, 9}, hasNext: true, hasPrev: true},
+		{name: "past the end", from: "third", ids: []int64{}, hasPrev: true},
+		{name: "back to third", from: "past the end", prev: true, ids: []int64{6, 3, 9}, hasNext: true, hasPrev: true},
+		{name: "back to second", from: "back to third", prev: true, ids: []int64{4, 1, 7}, hasNext: true, hasPrev: true},
+		{name: "back to first", from: "back to second", prev: true, ids: []int64{2, 8, 5}, hasNext: true, hasPrev: true},
+		{name: "before the start", from: "back to first", prev: true, ids: []int64{}, hasNext: true},
+		{name: "first again", from: "before the start", ids: []int64{2, 8, 5}, hasNext: true, hasPrev: true},
+		{name: "second again", from: "first again", ids: []int64{4, 1, 7}, hasNext: true, hasPrev: true},
+	}
+
+	nextCursors := map[string]string{}
+	prevCursors := map[string]string{}
+	for _, test := range tests {
+		input := nextCursors[test.from]
+		if test.prev {
+			input = prevCursors[test.from]
+		}
+		ids, next, prev := fetchPage(input)
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("%v page: loaded %v, expected %v", test.name, ids, test.ids)
+		}
+		if (next != "") != test.hasNext {
+			t.Errorf("%v page: next cursor is %q", test.name, next)
+		}
+		if (prev != "") != test.hasPrev {
+			t.Errorf("%v page: previous cursor is %q", test.name, prev)
+		}
+		nextCursors[test.name] = next
+		prevCursors[test.name] = prev
+	}
+}
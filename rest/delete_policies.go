@@ -0,0 +1,218 @@
+package rest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/go-carrot/surf"
+)
+
+const (
+	DELETE_CASCADE  = "CASCADE"
+	DELETE_RESTRICT = "RESTRICT"
+	DELETE_NULLIFY  = "NULLIFY"
+)
+
+// DeletePolicy determines what happens to the child models that reference a model
+// when the model is deleted
+type DeletePolicy struct {
+	// GetModel builds a child model
+	GetModel surf.BuildModel
+
+	// ForeignReference is the field of the child model that references the deleted model
+	ForeignReference string
+
+	// Action is DELETE_CASCADE to delete the children, DELETE_RESTRICT to prevent the
+	// delete while there are children, or DELETE_NULLIFY to null out the ForeignReference
+	// of the children.  DELETE_NULLIFY leaves the children alone on soft deletes.
+	Action string
+
+	// ModelFields are the fields of the child model.  The deleted at field is used to
+	// cascade soft deletes.
+	ModelFields ModelFields
+
+	// DeletePolicies are the delete policies of the child model, which DELETE_CASCADE
+	// applies to each child before deleting it
+	DeletePolicies []DeletePolicy
+}
+
+// deleteRestrictedError is returned when a DELETE_RESTRICT policy prevents a delete
+type deleteRestrictedError struct {
+	TableName      string
+	Id             interface{}
+	ChildTableName string
+}
+
+func (e deleteRestrictedError) Error() string {
+	return fmt.Sprintf("%v '%v' can't be deleted while %v reference it.", e.TableName, e.Id, e.ChildTableName)
+}
+
+// validateDeletePolicies panics if a controller has delete policies that can't be
+// applied, so the controller fails when it is registered instead of on every DELETE
+func validateDeletePolicies(tableName string, policies []DeletePolicy, database *sql.DB) {
+	if len(policies) > 0 && database == nil {
+		panic("rest: the '" + tableName + "' controller must have a Database to apply its DeletePolicies within a transaction")
+	}
+	for _, policy := range policies {
+		if policy.Action != DELETE_CASCADE && policy.Action != DELETE_RESTRICT && policy.Action != DELETE_NULLIFY {
+			panic("rest: delete policy action '" + policy.Action + "' of the '" + tableName + "' controller is not supported")
+		}
+		validateDeletePolicies(tableName, policy.DeletePolicies, database)
+	}
+}
+
+// applyDeletePolicies applies the delete policies of a model that is about to be deleted.
+// The policies must be applied within the transaction of the request.
+//
+// When the model is soft deleted, deletedAt is the time it is deleted at, and
+// DELETE_CASCADE soft deletes the children at that same time, so they can be restored
+// along with the model, while DELETE_NULLIFY keeps the references of the children, which
+// a restore couldn't bring back.  Otherwise, deletedAt is the zero time.
+//
+// DELETE_CASCADE applies the policies of the children before deleting them, so a
+// cascade goes down every level of the policies.
+func applyDeletePolicies(r *http.Request, model surf.Model, idField string, policies []DeletePolicy, deletedAt time.Time) error {
+	if len(policies) == 0 {
+		return nil
+	}
+	if Tx(r) == nil {
+		return errors.New("A Database must be set on the controller to apply delete policies within a transaction.")
+	}
+
+	id, _ := fieldValue(model, idField)
+	for _, policy := range policies {
+		predicates := []surf.Predicate{{
+			Field:         policy.ForeignReference,
+			PredicateType: surf.WHERE_EQUAL,
+			Values:        []interface{}{id},
+		}}
+		switch policy.Action {
+		case DELETE_RESTRICT:
+			children, err := policy.children(r, predicates, 1)
+			if err != nil {
+				return err
+			}
+			if len(children) > 0 {
+				return deleteRestrictedError{
+					TableName:      model.GetConfiguration().TableName,
+					Id:             id,
+					ChildTableName: children[0].GetConfiguration().TableName,
+				}
+			}
+		case DELETE_CASCADE:
+			// Soft delete every child along with the model
+			if !deletedAt.IsZero() {
+				children, err := policy.children(r, append(predicates, notDeletedPredicate(policy.ModelFields)), int(math.MaxInt32))
+				if err != nil {
+					return err
+				}
+				for _, child := range children {
+					err = applyDeletePolicies(r, child, policy.ModelFields.idField(), policy.DeletePolicies, deletedAt)
+					if err != nil {
+						return err
+					}
+					err = softDeleteModel(r, child, policy.ModelFields, deletedAt)
+					if err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			// Apply the policies of every child
+			if len(policy.DeletePolicies) > 0 {
+				children, err := policy.children(r, predicates, int(math.MaxInt32))
+				if err != nil {
+					return err
+				}
+				for _, child := range children {
+					err = applyDeletePolicies(r, child, policy.ModelFields.idField(), policy.DeletePolicies, deletedAt)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			// Delete every child in one query
+			err := deleteModels(r, policy.GetModel, predicates)
+			if err != nil {
+				return err
+			}
+		case DELETE_NULLIFY:
+			// Keep the references of the children on soft deletes, so a restore brings them back
+			if !deletedAt.IsZero() {
+				continue
+			}
+			children, err := policy.children(r, predicates, int(math.MaxInt32))
+			if err != nil {
+				return err
+			}
+			for _, child := range children {
+				err = clearFieldValue(child, policy.ForeignReference)
+				if err != nil {
+					return err
+				}
+				err = updateModel(r, child, policy.ModelFields)
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("Delete policy action '%v' is not supported.", policy.Action)
+		}
+	}
+	return nil
+}
+
+// restoreDeletePolicies restores the children that DELETE_CASCADE policies soft deleted
+// along with a model, which share the deletedAt of the model, at every level of the policies
+func restoreDeletePolicies(r *http.Request, model surf.Model, idField string, policies []DeletePolicy, deletedAt time.Time) error {
+	if deletedAt.IsZero() {
+		return nil
+	}
+
+	id, _ := fieldValue(model, idField)
+	for _, policy := range policies {
+		if policy.Action != DELETE_CASCADE {
+			continue
+		}
+		children, err := policy.children(r, []surf.Predicate{
+			{
+				Field:         policy.ForeignReference,
+				PredicateType: surf.WHERE_EQUAL,
+				Values:        []interface{}{id},
+			},
+			{
+				Field:         policy.ModelFields.deletedAtField(),
+				PredicateType: surf.WHERE_EQUAL,
+				Values:        []interface{}{deletedAt},
+			},
+		}, int(math.MaxInt32))
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			err = restoreDeletePolicies(r, child, policy.ModelFields.idField(), policy.DeletePolicies, deletedAt)
+			if err != nil {
+				return err
+			}
+			err = restoreModel(r, child, policy.ModelFields)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// children loads the child models matching predicates within the transaction of the request
+func (p DeletePolicy) children(r *http.Request, predicates []surf.Predicate, limit int) ([]surf.Model, error) {
+	return fetchModels(r, p.GetModel, surf.BulkFetchConfig{
+		Limit:      limit,
+		Predicates: predicates,
+	})
+}
@@ -0,0 +1,180 @@
+package rest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDriver is a database/sql driver that records the statement (first word) of
+// each query, and answers SELECT queries with testDriverRows
+type testDriver struct{}
+
+var (
+	testDriverQueries []string
+	testDriverRows    [][]driver.Value
+)
+
+func init() {
+	sql.Register("rest_test", testDriver{})
+}
+
+func (testDriver) Open(name string) (driver.Conn, error) { return testConn{}, nil }
+
+type testConn struct{}
+
+func (testConn) Prepare(query string) (driver.Stmt, error) { return testStmt{query}, nil }
+func (testConn) Close() error                              { return nil }
+func (testConn) Begin() (driver.Tx, error)                 { return testConn{}, nil }
+func (testConn) Commit() error                             { return nil }
+func (testConn) Rollback() error                           { return nil }
+
+type testStmt struct {
+	query string
+}
+
+func (s testStmt) Close() error  { return nil }
+func (s testStmt) NumInput() int { return -1 }
+
+func (s testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	testDriverQueries = append(testDriverQueries, strings.Fields(s.query)[0])
+	return driver.RowsAffected(0), nil
+}
+
+func (s testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	testDriverQueries = append(testDriverQueries, strings.Fields(s.query)[0])
+	return &testDriverRowsIterator{rows: testDriverRows}, nil
+}
+
+type testDriverRowsIterator struct {
+	rows [][]driver.Value
+}
+
+func (i *testDriverRowsIterator) Columns() []string {
+	if len(i.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(i.rows[0]))
+}
+
+func (i *testDriverRowsIterator) Close() error { return nil }
+
+func (i *testDriverRowsIterator) Next(dest []driver.Value) error {
+	if len(i.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, i.rows[0])
+	i.rows = i.rows[1:]
+	return nil
+}
+
+func TestApplyDeletePolicies(t *testing.T) {
+	database, err := sql.Open("rest_test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := func(action string, policies ...DeletePolicy) DeletePolicy {
+		return DeletePolicy{GetModel: newTestPost, ForeignReference: "rank", Action: action, DeletePolicies: policies}
+	}
+	child := [][]driver.Value{{int64(2), int64(1), "child"}}
+
+	tests := []struct {
+		name      string
+		policies  []DeletePolicy
+		noTx      bool
+		deletedAt time.Time
+		rows      [][]driver.Value
+		queries   []string
+		fails     bool
+	}{
+		{name: "no policies without a transaction", noTx: true},
+		{name: "policies without a transaction", policies: []DeletePolicy{policy(DELETE_CASCADE)}, noTx: true, fails: true},
+		{name: "restrict without children", policies: []DeletePolicy{policy(DELETE_RESTRICT)}, queries: []string{"SELECT"}},
+		{name: "restrict with children", policies: []DeletePolicy{policy(DELETE_RESTRICT)}, rows: child, queries: []string{"SELECT"}, fails: true},
+		{name: "cascade", policies: []DeletePolicy{policy(DELETE_CASCADE)}, queries: []string{"DELETE"}},
+		{
+			name:     "cascade applies the policies of the children",
+			policies: []DeletePolicy{policy(DELETE_CASCADE, policy(DELETE_CASCADE))},
+			rows:     child,
+			queries:  []string{"SELECT", "DELETE", "DELETE"},
+		},
+		{
+			name:     "cascade stops at a restricted child",
+			policies: []DeletePolicy{policy(DELETE_CASCADE, policy(DELETE_RESTRICT))},
+			rows:     child,
+			queries:  []string{"SELECT", "SELECT"},
+			fails:    true,
+		},
+		{name: "soft cascade without children", policies: []DeletePolicy{policy(DELETE_CASCADE)}, deletedAt: time.Now(), queries: []string{"SELECT"}},
+		{name: "nullify without children", policies: []DeletePolicy{policy(DELETE_NULLIFY)}, queries: []string{"SELECT"}},
+		{name: "nullify on a soft delete", policies: []DeletePolicy{policy(DELETE_NULLIFY)}, deletedAt: time.Now(), rows: child},
+		{name: "unsupported action", policies: []DeletePolicy{policy("ARCHIVE")}, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("DELETE", "/posts/1", nil)
+			if !test.noTx {
+				r, err = beginTx(database, r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer rollbackTx(r)
+			}
+			testDriverQueries = nil
+			testDriverRows = test.rows
+
+			err := applyDeletePolicies(r, &testPost{Id: 1}, "id", test.policies, test.deletedAt)
+			if test.fails && err == nil {
+				t.Errorf("Expected an error")
+			}
+			if !test.fails && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(testDriverQueries, test.queries) {
+				t.Errorf("Ran %v, expected %v", testDriverQueries, test.queries)
+			}
+		})
+	}
+}
+
+func TestValidateDeletePolicies(t *testing.T) {
+	database, err := sql.Open("rest_test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		policies []DeletePolicy
+		database *sql.DB
+		panics   bool
+	}{
+		{name: "no policies without a Database"},
+		{name: "policies with a Database", policies: []DeletePolicy{{Action: DELETE_CASCADE}}, database: database},
+		{name: "policies without a Database", policies: []DeletePolicy{{Action: DELETE_CASCADE}}, panics: true},
+		{name: "unsupported action", policies: []DeletePolicy{{Action: "ARCHIVE"}}, database: database, panics: true},
+		{
+			name:     "unsupported nested action",
+			policies: []DeletePolicy{{Action: DELETE_CASCADE, DeletePolicies: []DeletePolicy{{Action: "ARCHIVE"}}}},
+			database: database,
+			panics:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recovered := recover(); (recovered != nil) != test.panics {
+					t.Errorf("Expected panicking to be %v, got %v", test.panics, recovered)
+				}
+			}()
+			validateDeletePolicies("posts", test.policies, test.database)
+		})
+	}
+}
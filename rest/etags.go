@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-carrot/surf"
+)
+
+// modelETag returns the strong entity tag of a model.  The entity tag is the version
+// of the model when its ModelFields have a `Version`, otherwise a hash of its content.
+func modelETag(model surf.Model, modelFields ModelFields) (string, error) {
+	if modelFields.Version != "" {
+		version, ok := fieldKey(model, modelFields.Version)
+		if !ok {
+			return "", fmt.Errorf("Model '%v' does not have a version field '%v'", model.GetConfiguration().TableName, modelFields.Version)
+		}
+		return `"` + version + `"`, nil
+	}
+	raw, err := json.Marshal(model)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// relatedETag returns the strong entity tag of a nested model related through a
+// relation model, which changes when either of them changes
+func relatedETag(relation surf.Model, nestedModel surf.Model, nestedModelFields ModelFields) (string, error) {
+	relationETag, err := modelETag(relation, ModelFields{})
+	if err != nil {
+		return "", err
+	}
+	nestedModelETag, err := modelETag(nestedModel, nestedModelFields)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(relationETag + nestedModelETag))
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// https://tools.ietf.org/html/rfc7232#section-3.1
+//
+// > An origin server MUST use the strong comparison function when
+// > comparing entity-tags for If-Match...
+func isMatchHeader(etag string, r *http.Request) bool {
+	header := r.Header["If-Match"]
+	if len(header) > 0 {
+		return containsETag(header, etag, false)
+	}
+	return true
+}
+
+// https://tools.ietf.org/html/rfc7232#section-3.2
+//
+// > A recipient MUST use the weak comparison function when comparing
+// > entity-tags for If-None-Match...
+func isNoneMatchHeader(etag string, r *http.Request) bool {
+	header := r.Header["If-None-Match"]
+	if len(header) > 0 {
+		return !containsETag(header, etag, true)
+	}
+	return true
+}
+
+// containsETag returns whether the entity tags listed in a header contain etag.
+// Weak entity tags only match when weak is set.
+func containsETag(header []string, etag string, weak bool) bool {
+	for _, line := range header {
+		for _, candidate := range strings.Split(line, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" {
+				return true
+			}
+			if weak {
+				candidate = strings.TrimPrefix(candidate, "W/")
+			}
+			if candidate == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContainsETag(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []string
+		weak     bool
+		expected bool
+	}{
+		{name: "strong match", header: []string{`"a"`}, expected: true},
+		{name: "strong mismatch", header: []string{`"b"`}},
+		{name: "weak tag with strong comparison", header: []string{`W/"a"`}},
+		{name: "weak tag with weak comparison", header: []string{`W/"a"`}, weak: true, expected: true},
+		{name: "strong tag with weak comparison", header: []string{`"a"`}, weak: true, expected: true},
+		{name: "wildcard", header: []string{"*"}, expected: true},
+		{name: "wildcard with weak comparison", header: []string{"*"}, weak: true, expected: true},
+		{name: "list", header: []string{`"b", "a"`}, expected: true},
+		{name: "list without spaces", header: []string{`"b","a","c"`}, expected: true},
+		{name: "list of mismatches", header: []string{`"b", W/"c"`}},
+		{name: "list with a weak match", header: []string{`"b", W/"a"`}, weak: true, expected: true},
+		{name: "repeated headers", header: []string{`"b"`, `"a"`}, expected: true},
+		{name: "unquoted tag", header: []string{`a`}},
+		{name: "empty header", header: []string{""}},
+	}
+
+	for _, test := range tests {
+		if containsETag(test.header, `"a"`, test.weak) != test.expected {
+			t.Errorf("%v: expected %v for %q", test.name, test.expected, test.header)
+		}
+	}
+}
+
+func TestConditionalHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		value     string
+		match     bool
+		noneMatch bool
+	}{
+		{name: "no headers", match: true, noneMatch: true},
+		{name: "If-Match match", header: "If-Match", value: `"a"`, match: true, noneMatch: true},
+		{name: "If-Match mismatch", header: "If-Match", value: `"b"`, noneMatch: true},
+		{name: "If-Match weak", header: "If-Match", value: `W/"a"`, noneMatch: true},
+		{name: "If-Match wildcard", header: "If-Match", value: "*", match: true, noneMatch: true},
+		{name: "If-None-Match match", header: "If-None-Match", value: `"a"`, match: true},
+		{name: "If-None-Match mismatch", header: "If-None-Match", value: `"b"`, match: true, noneMatch: true},
+		{name: "If-None-Match weak", header: "If-None-Match", value: `W/"a"`, match: true},
+		{name: "If-None-Match wildcard", header: "If-None-Match", value: "*", match: true},
+		{name: "If-None-Match list", header: "If-None-Match", value: `"b", "a"`, match: true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/posts/1", nil)
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		if isMatchHeader(`"a"`, r) != test.match {
+			t.Errorf("%v: expected isMatchHeader to be %v", test.name, test.match)
+		}
+		if isNoneMatchHeader(`"a"`, r) != test.noneMatch {
+			t.Errorf("%v: expected isNoneMatchHeader to be %v", test.name, test.noneMatch)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/go-carrot/surf"
+)
+
+// fieldValue returns the value of a field of a model.  Returns false if the
+// field doesn't exist, or is null.
+//
+// Fields that implement driver.Valuer (null.*, UUID types, etc.) return
+// their database value.
+func fieldValue(model surf.Model, name string) (interface{}, bool) {
+	for _, field := range model.GetConfiguration().Fields {
+		if field.Name == name {
+			if valuer, isValuer := field.Pointer.(driver.Valuer); isValuer {
+				value, err := valuer.Value()
+				return value, err == nil && value != nil
+			}
+			value := reflect.ValueOf(field.Pointer)
+			if value.Kind() == reflect.Ptr {
+				value = value.Elem()
+			}
+			return value.Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// fieldKey returns a comparable key of the value of a field of a model
+func fieldKey(model surf.Model, name string) (string, bool) {
+	value, ok := fieldValue(model, name)
+	return fmt.Sprint(value), ok
+}
+
+// isFieldSet returns whether the field of a model is set to a non-zero value
+func isFieldSet(model surf.Model, name string) bool {
+	value, ok := fieldValue(model, name)
+	return ok && !reflect.ValueOf(value).IsZero()
+}
+
+// setFieldValue sets the field of a model to value, converting it to the type
+// of the field
+func setFieldValue(model surf.Model, name string, value interface{}) error {
+	for _, field := range model.GetConfiguration().Fields {
+		if field.Name == name {
+			return assignFieldValue(field.Pointer, value)
+		}
+	}
+	return fmt.Errorf("Model '%v' does not have a field '%v'", model.GetConfiguration().TableName, name)
+}
+
+// clearFieldValue sets the field of a model to null.  The field must be a
+// nullable type, with a `Valid` field (null.*, sql.Null*, etc.)
+func clearFieldValue(model surf.Model, name string) error {
+	for _, field := range model.GetConfiguration().Fields {
+		if field.Name == name {
+			value := reflect.ValueOf(field.Pointer).Elem()
+			if value.Kind() == reflect.Struct {
+				valid := value.FieldByName("Valid")
+				if valid.IsValid() && valid.Kind() == reflect.Bool && valid.CanSet() {
+					valid.SetBool(false)
+					return nil
+				}
+			}
+			return fmt.Errorf("%v.%v is not nullable", model.GetConfiguration().TableName, name)
+		}
+	}
+	return fmt.Errorf("Model '%v' does not have a field '%v'", model.GetConfiguration().TableName, name)
+}
+
+// isNullableField returns whether a field can be null: a pointer, or a type with
+// a `Valid` field (null.*, sql.Null*, etc.)
+func isNullableField(field surf.Field) bool {
+	value := reflect.ValueOf(field.Pointer).Elem()
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return true
+	case reflect.Struct:
+		valid := value.FieldByName("Valid")
+		return valid.IsValid() && valid.Kind() == reflect.Bool
+	}
+	return false
+}
+
+func assignFieldValue(pointer interface{}, value interface{}) error {
+	// Scanners (null.*, UUID types, etc.) know how to convert database values
+	if scanner, isScanner := pointer.(sql.Scanner); isScanner {
+		return scanner.Scan(value)
+	}
+
+	// Values of the same type can be set directly
+	target := reflect.ValueOf(pointer).Elem()
+	source := reflect.ValueOf(value)
+	if source.IsValid() && source.Type().AssignableTo(target.Type()) {
+		target.Set(source)
+		return nil
+	}
+	return parseFieldInput(pointer, fmt.Sprint(value))
+}
+
+// parseFieldInput parses an input into a field, based on the type of the field.
+//
+// Supports integers, strings, and any type that implements sql.Scanner or
+// encoding.TextUnmarshaler, which covers the common UUID types.
+func parseFieldInput(pointer interface{}, input string) error {
+	switch v := pointer.(type) {
+	case encoding.TextUnmarshaler:
+		return v.UnmarshalText([]byte(input))
+	case sql.Scanner:
+		return v.Scan(input)
+	}
+
+	target := reflect.ValueOf(pointer).Elem()
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(input)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(input, 10, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+		target.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(input, 10, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+		target.SetUint(u)
+		return nil
+	}
+	return fmt.Errorf("Type %T is not supported", pointer)
+}
@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testUUID is a UUID type implementing encoding.TextUnmarshaler, like the common UUID packages
+type testUUID [16]byte
+
+func (u *testUUID) UnmarshalText(text []byte) error {
+	decoded, err := hex.DecodeString(strings.Replace(string(text), "-", "", -1))
+	if err != nil || len(decoded) != len(u) {
+		return errors.New("invalid UUID")
+	}
+	copy(u[:], decoded)
+	return nil
+}
+
+// testCode is a type implementing sql.Scanner, which only accepts upper case codes
+type testCode string
+
+func (c *testCode) Scan(value interface{}) error {
+	s := fmt.Sprint(value)
+	if s != strings.ToUpper(s) {
+		return errors.New("invalid code")
+	}
+	*c = testCode(s)
+	return nil
+}
+
+func TestParseFieldInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		pointer  interface{}
+		input    string
+		expected interface{}
+		fails    bool
+	}{
+		{name: "string", pointer: new(string), input: "abc", expected: "abc"},
+		{name: "int64", pointer: new(int64), input: "-42", expected: int64(-42)},
+		{name: "int8", pointer: new(int8), input: "127", expected: int8(127)},
+		{name: "int8 overflow", pointer: new(int8), input: "128", fails: true},
+		{name: "int64 overflow", pointer: new(int64), input: "9223372036854775808", fails: true},
+		{name: "uint16", pointer: new(uint16), input: "65535", expected: uint16(65535)},
+		{name: "uint16 overflow", pointer: new(uint16), input: "65536", fails: true},
+		{name: "negative uint", pointer: new(uint), input: "-1", fails: true},
+		{name: "invalid int", pointer: new(int), input: "1.5", fails: true},
+		{
+			name:     "UUID",
+			pointer:  new(testUUID),
+			input:    "123e4567-e89b-12d3-a456-426614174000",
+			expected: testUUID{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00},
+		},
+		{name: "invalid UUID", pointer: new(testUUID), input: "123", fails: true},
+		{name: "Scanner", pointer: new(testCode), input: "ABC", expected: testCode("ABC")},
+		{name: "invalid Scanner input", pointer: new(testCode), input: "abc", fails: true},
+		{name: "unsupported type", pointer: new(float64), input: "1.5", fails: true},
+	}
+
+	for _, test := range tests {
+		err := parseFieldInput(test.pointer, test.input)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%v: expected %q to fail", test.name, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error for %q: %v", test.name, test.input, err)
+			continue
+		}
+		value := reflect.ValueOf(test.pointer).Elem().Interface()
+		if !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("%v: parsed %q as %v, expected %v", test.name, test.input, value, test.expected)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/go-carrot/surf"
+)
+
+// splitFields splits the validated `fields` parameter.  Returns nil if every
+// field should be returned.
+func splitFields(input string) []string {
+	if input == "" {
+		return nil
+	}
+	return strings.Split(input, ",")
+}
+
+// selectingModel returns a BuildModel that narrows the configuration of each model
+// to the selected fields, so only those columns are selected.
+//
+// The idField, every field bulkFetchConfig sorts on, and any required fields are always
+// selected, as they are needed to load and page through the models.
+func selectingModel(buildModel surf.BuildModel, idField string, fields []string, bulkFetchConfig surf.BulkFetchConfig, required ...string) surf.BuildModel {
+	if fields == nil {
+		return buildModel
+	}
+
+	// Determine which fields need to be selected
+	selected := append([]string{idField}, fields...)
+	selected = append(selected, required...)
+	for _, orderBy := range bulkFetchConfig.OrderBys {
+		selected = append(selected, orderBy.Field)
+	}
+
+	return func() surf.Model {
+		model := buildModel()
+		configuration := model.GetConfiguration()
+		var selectedFields []surf.Field
+		for _, field := range configuration.Fields {
+			if contains(selected, field.Name) {
+				selectedFields = append(selectedFields, field)
+			}
+		}
+		configuration.Fields = selectedFields
+		return model
+	}
+}
+
+// sparseModel returns only the selected fields of a model, or the model itself
+// if every field is selected
+func sparseModel(model surf.Model, fields []string) (interface{}, error) {
+	if fields == nil {
+		return model, nil
+	}
+	return sparseFields(model, fields)
+}
+
+// sparseModels returns only the selected fields of each model, or the models
+// themselves if every field is selected
+func sparseModels(models []surf.Model, fields []string) (interface{}, error) {
+	if fields == nil {
+		return models, nil
+	}
+	sparse := make([]map[string]interface{}, len(models))
+	for i, model := range models {
+		document, err := sparseFields(model, fields)
+		if err != nil {
+			return nil, err
+		}
+		sparse[i] = document
+	}
+	return sparse, nil
+}
+
+// sparseFields marshals a model and keeps the keys of the selected fields, so
+// the sparse output is encoded exactly like the full model
+func sparseFields(model surf.Model, fields []string) (map[string]interface{}, error) {
+	raw, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]json.RawMessage
+	err = json.Unmarshal(raw, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	sparse := map[string]interface{}{}
+	for name, key := range jsonFieldKeys(model) {
+		if value, ok := document[key]; ok && contains(fields, name) {
+			sparse[key] = value
+		}
+	}
+	return sparse, nil
+}
+
+// jsonFieldKeys maps the name of each field of a model to the key it is marshalled
+// under.  Fields that aren't marshalled (tagged `json:"-"`, unexported, or not a
+// field of the model's struct) are left out.
+func jsonFieldKeys(model surf.Model) map[string]string {
+	value := reflect.ValueOf(model)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	keys := map[jsonFieldAddress]string{}
+	if value.Kind() == reflect.Struct && value.CanAddr() {
+		collectJSONKeys(value, keys)
+	}
+
+	fieldKeys := map[string]string{}
+	for _, field := range model.GetConfiguration().Fields {
+		pointer := reflect.ValueOf(field.Pointer)
+		if pointer.Kind() != reflect.Ptr || pointer.IsNil() {
+			continue
+		}
+		address := jsonFieldAddress{pointer.Pointer(), pointer.Type().Elem()}
+		if key, ok := keys[address]; ok {
+			fieldKeys[field.Name] = key
+		}
+	}
+	return fieldKeys
+}
+
+// jsonFieldAddress identifies a struct field by its address and type, as the first
+// field of a struct shares its address with the struct itself
+type jsonFieldAddress struct {
+	pointer   uintptr
+	fieldType reflect.Type
+}
+
+// collectJSONKeys adds the address of each marshalled field of a struct to keys,
+// following embedded structs like encoding/json does
+func collectJSONKeys(value reflect.Value, keys map[jsonFieldAddress]string) {
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		structField := structType.Field(i)
+		tag := structField.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		// Promote the fields of untagged embedded structs
+		fieldValue := value.Field(i)
+		if structField.Anonymous && name == "" {
+			if fieldValue.Kind() == reflect.Ptr {
+				if fieldValue.IsNil() {
+					continue
+				}
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.Struct {
+				collectJSONKeys(fieldValue, keys)
+				continue
+			}
+		}
+
+		if structField.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = structField.Name
+		}
+		keys[jsonFieldAddress{fieldValue.UnsafeAddr(), structField.Type}] = name
+	}
+}
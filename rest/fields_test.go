@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/go-carrot/surf"
+)
+
+type testTimestamps struct {
+	CreatedAt string `json:"created_at"`
+}
+
+// testAuthor is a model whose fields are renamed, hidden and promoted when marshalled
+type testAuthor struct {
+	Id       int64  `json:"id"`
+	Name     string `json:"display_name,omitempty"`
+	Password string `json:"-"`
+	Email    string
+	testTimestamps
+}
+
+func (a *testAuthor) GetConfiguration() *surf.Configuration {
+	return &surf.Configuration{
+		TableName: "authors",
+		Fields: []surf.Field{
+			{Pointer: &a.Id, Name: "id", UniqueIdentifier: true},
+			{Pointer: &a.Name, Name: "name"},
+			{Pointer: &a.Password, Name: "password"},
+			{Pointer: &a.Email, Name: "email"},
+			{Pointer: &a.CreatedAt, Name: "created_at"},
+		},
+	}
+}
+
+func (a *testAuthor) Insert() error { return nil }
+func (a *testAuthor) Load() error   { return nil }
+func (a *testAuthor) Update() error { return nil }
+func (a *testAuthor) Delete() error { return nil }
+func (a *testAuthor) BulkFetch(surf.BulkFetchConfig, surf.BuildModel) ([]surf.Model, error) {
+	return nil, nil
+}
+
+func TestJSONFieldKeys(t *testing.T) {
+	keys := jsonFieldKeys(&testAuthor{})
+	expected := map[string]string{
+		"id":         "id",
+		"name":       "display_name",
+		"email":      "Email",
+		"created_at": "created_at",
+	}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Keys are %v, expected %v", keys, expected)
+	}
+}
+
+func TestSparseFields(t *testing.T) {
+	author := &testAuthor{Id: 1, Name: "Ann", Password: "secret", Email: "ann@example.com", testTimestamps: testTimestamps{CreatedAt: "2020"}}
+	tests := []struct {
+		fields   []string
+		expected string
+	}{
+		{fields: []string{"id"}, expected: `{"id": 1}`},
+		{fields: []string{"name", "created_at"}, expected: `{"display_name": "Ann", "created_at": "2020"}`},
+		{fields: []string{"email", "password"}, expected: `{"Email": "ann@example.com"}`},
+	}
+
+	for _, test := range tests {
+		sparse, err := sparseFields(author, test.fields)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", test.fields, err)
+		}
+		raw, err := json.Marshal(sparse)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", test.fields, err)
+		}
+		var output, expected interface{}
+		json.Unmarshal(raw, &output)
+		json.Unmarshal([]byte(test.expected), &expected)
+		if !reflect.DeepEqual(output, expected) {
+			t.Errorf("Fields %v gave %s, expected %s", test.fields, raw, test.expected)
+		}
+	}
+}
+
+func TestValidateFieldsField(t *testing.T) {
+	validate := validateFieldsField(&testAuthor{})
+	tests := []struct {
+		input string
+		fails bool
+	}{
+		{input: ""},
+		{input: "id,name"},
+		{input: "email,created_at"},
+		{input: "password", fails: true},
+		{input: "display_name", fails: true},
+		{input: "id,unknown", fails: true},
+	}
+
+	for _, test := range tests {
+		err := validate("fields", test.input)
+		if test.fails && err == nil {
+			t.Errorf("Expected %q to be invalid", test.input)
+		}
+		if !test.fails && err != nil {
+			t.Errorf("Unexpected error for %q: %v", test.input, err)
+		}
+	}
+}
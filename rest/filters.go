@@ -0,0 +1,174 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-carrot/surf"
+)
+
+const (
+	FILTER_EQUAL                    = "eq"
+	FILTER_NOT_EQUAL                = "ne"
+	FILTER_GREATER_THAN             = "gt"
+	FILTER_GREATER_THAN_OR_EQUAL_TO = "gte"
+	FILTER_LESS_THAN                = "lt"
+	FILTER_LESS_THAN_OR_EQUAL_TO    = "lte"
+	FILTER_IN                       = "in"
+	FILTER_NOT_IN                   = "not_in"
+	FILTER_LIKE                     = "like"
+	FILTER_IS_NULL                  = "is_null"
+)
+
+var filterPredicateTypes = map[string]surf.PredicateType{
+	FILTER_EQUAL:                    surf.WHERE_EQUAL,
+	FILTER_NOT_EQUAL:                surf.WHERE_NOT_EQUAL,
+	FILTER_GREATER_THAN:             surf.WHERE_GREATER_THAN,
+	FILTER_GREATER_THAN_OR_EQUAL_TO: surf.WHERE_GREATER_THAN_OR_EQUAL_TO,
+	FILTER_LESS_THAN:                surf.WHERE_LESS_THAN,
+	FILTER_LESS_THAN_OR_EQUAL_TO:    surf.WHERE_LESS_THAN_OR_EQUAL_TO,
+	FILTER_IN:                       surf.WHERE_IN,
+	FILTER_NOT_IN:                   surf.WHERE_NOT_IN,
+	FILTER_LIKE:                     surf.WHERE_LIKE,
+}
+
+// getFilterPredicates converts the filter parameters of a request into predicates.
+//
+// Filters are in the format `filter[field]=value`, which is equivalent to
+// `filter[field][eq]=value`, or `filter[field][operator]=value`.
+//
+// Only fields that are part of the model's output may be filtered on, so fields
+// tagged `json:"-"` can't be probed.  If whiteList is set, only fields within the
+// whiteList may be filtered on, which also allows fields that aren't marshalled.
+// If disabled is set, no filters are allowed at all.
+func getFilterPredicates(r *http.Request, model surf.Model, whiteList []string, disabled bool) ([]surf.Predicate, error) {
+	// Sort keys, so predicates are always generated in the same order
+	query := r.URL.Query()
+	var keys []string
+	for key := range query {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	// Build predicates
+	var predicates []surf.Predicate
+	for _, key := range keys {
+		if disabled {
+			return nil, fmt.Errorf("Parameter '%v' is invalid. Filtering is not allowed.", key)
+		}
+		fieldName, operator, err := parseFilterKey(key)
+		if err != nil {
+			return nil, err
+		}
+		err = validateFilterField(key, fieldName, model, whiteList)
+		if err != nil {
+			return nil, err
+		}
+		for _, input := range query[key] {
+			predicate, err := filterPredicate(key, fieldName, operator, input)
+			if err != nil {
+				return nil, err
+			}
+			predicates = append(predicates, predicate)
+		}
+	}
+	return predicates, nil
+}
+
+// parseFilterKey splits `filter[field][operator]` into its field name and operator
+func parseFilterKey(key string) (string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(key, "filter"), "]")
+	if len(parts) < 2 || len(parts) > 3 || parts[len(parts)-1] != "" {
+		return "", "", fmt.Errorf("Parameter '%v' is not a valid filter.", key)
+	}
+	for _, part := range parts[:len(parts)-1] {
+		if !strings.HasPrefix(part, "[") || len(part) < 2 {
+			return "", "", fmt.Errorf("Parameter '%v' is not a valid filter.", key)
+		}
+	}
+	fieldName := parts[0][1:]
+	operator := FILTER_EQUAL
+	if len(parts) == 3 {
+		operator = parts[1][1:]
+	}
+	return fieldName, operator, nil
+}
+
+func validateFilterField(name string, fieldName string, model surf.Model, whiteList []string) error {
+	if len(whiteList) != 0 {
+		if !contains(whiteList, fieldName) {
+			return fmt.Errorf("Parameter '%v' is invalid. Filtering on '%v' is not allowed.", name, fieldName)
+		}
+		for _, field := range model.GetConfiguration().Fields {
+			if field.Name == fieldName {
+				return nil
+			}
+		}
+	} else if _, isMarshalled := jsonFieldKeys(model)[fieldName]; isMarshalled {
+		return nil
+	}
+	return fmt.Errorf("Parameter '%v' must only contain fields within the model. Input '%v' is invalid.", name, fieldName)
+}
+
+func filterPredicate(name string, fieldName string, operator string, input string) (surf.Predicate, error) {
+	predicate := surf.Predicate{Field: fieldName}
+	switch operator {
+	case FILTER_IS_NULL:
+		switch input {
+		case "true":
+			predicate.PredicateType = surf.WHERE_IS_NULL
+		case "false":
+			predicate.PredicateType = surf.WHERE_IS_NOT_NULL
+		default:
+			return predicate, fmt.Errorf("Parameter '%v' must be either 'true' or 'false'.", name)
+		}
+	case FILTER_IN, FILTER_NOT_IN:
+		values, err := splitFilterValues(name, input)
+		if err != nil {
+			return predicate, err
+		}
+		predicate.PredicateType = filterPredicateTypes[operator]
+		predicate.Values = values
+	default:
+		predicateType, ok := filterPredicateTypes[operator]
+		if !ok {
+			return predicate, fmt.Errorf("Parameter '%v' has an unsupported operator '%v'.", name, operator)
+		}
+		predicate.PredicateType = predicateType
+		predicate.Values = []interface{}{input}
+	}
+	return predicate, nil
+}
+
+// splitFilterValues splits the comma separated input of an `in` or `not_in` filter.
+// A comma or backslash within a value is escaped with a backslash.
+func splitFilterValues(name string, input string) ([]interface{}, error) {
+	var values []interface{}
+	var value strings.Builder
+	escaped := false
+	for _, char := range input {
+		switch {
+		case escaped:
+			if char != ',' && char != '\\' {
+				return nil, fmt.Errorf("Parameter '%v' has an invalid escape '\\%c'. Only ',' and '\\' can be escaped.", name, char)
+			}
+			value.WriteRune(char)
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case char == ',':
+			values = append(values, value.String())
+			value.Reset()
+		default:
+			value.WriteRune(char)
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("Parameter '%v' ends with an incomplete escape.", name)
+	}
+	return append(values, value.String()), nil
+}
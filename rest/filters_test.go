@@ -0,0 +1,218 @@
+package rest
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/go-carrot/surf"
+)
+
+func TestParseFilterKey(t *testing.T) {
+	tests := []struct {
+		key       string
+		fieldName string
+		operator  string
+		fails     bool
+	}{
+		{key: "filter[name]", fieldName: "name", operator: FILTER_EQUAL},
+		{key: "filter[name][eq]", fieldName: "name", operator: FILTER_EQUAL},
+		{key: "filter[age][gte]", fieldName: "age", operator: FILTER_GREATER_THAN_OR_EQUAL_TO},
+		{key: "filter[id][not_in]", fieldName: "id", operator: FILTER_NOT_IN},
+		{key: "filter[deleted_at][is_null]", fieldName: "deleted_at", operator: FILTER_IS_NULL},
+		{key: "filter[name][unknown]", fieldName: "name", operator: "unknown"},
+		{key: "filter", fails: true},
+		{key: "filter[", fails: true},
+		{key: "filter[]", fails: true},
+		{key: "filter[name", fails: true},
+		{key: "filter[name][]", fails: true},
+		{key: "filter[name]eq", fails: true},
+		{key: "filter[name][eq", fails: true},
+		{key: "filter[name][eq][x]", fails: true},
+		{key: "filter[name]x[eq]", fails: true},
+		{key: "filtername]", fails: true},
+	}
+
+	for _, test := range tests {
+		fieldName, operator, err := parseFilterKey(test.key)
+		if test.fails {
+			if err == nil {
+				t.Errorf("Expected %q to be invalid, got field %q and operator %q", test.key, fieldName, operator)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", test.key, err)
+			continue
+		}
+		if fieldName != test.fieldName || operator != test.operator {
+			t.Errorf("Parsed %q as field %q and operator %q, expected %q and %q", test.key, fieldName, operator, test.fieldName, test.operator)
+		}
+	}
+}
+
+func TestFilterPredicate(t *testing.T) {
+	tests := []struct {
+		operator  string
+		input     string
+		predicate surf.Predicate
+		fails     bool
+	}{
+		{
+			operator:  FILTER_EQUAL,
+			input:     "5",
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_EQUAL, Values: []interface{}{"5"}},
+		},
+		{
+			operator:  FILTER_NOT_EQUAL,
+			input:     "5",
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_NOT_EQUAL, Values: []interface{}{"5"}},
+		},
+		{
+			operator:  FILTER_GREATER_THAN,
+			input:     "5",
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_GREATER_THAN, Values: []interface{}{"5"}},
+		},
+		{
+			operator:  FILTER_GREATER_THAN_OR_EQUAL_TO,
+			input:     "5",
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_GREATER_THAN_OR_EQUAL_TO, Values: []interface{}{"5"}},
+		},
+		{
+			operator:  FILTER_LESS_THAN,
+			input:     "5",
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_LESS_THAN, Values: []interface{}{"5"}},
+		},
+		{
+			operator:  FILTER_LESS_THAN_OR_EQUAL_TO,
+			input:     "5",
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_LESS_THAN_OR_EQUAL_TO, Values: []interface{}{"5"}},
+		},
+		{
+			operator:  FILTER_LIKE,
+			input:     "%a%",
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_LIKE, Values: []interface{}{"%a%"}},
+		},
+		{
+			operator:  FILTER_IN,
+			input:     "1,2,3",
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_IN, Values: []interface{}{"1", "2", "3"}},
+		},
+		{
+			operator:  FILTER_IN,
+			input:     `a\,b,c\\,`,
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_IN, Values: []interface{}{"a,b", `c\`, ""}},
+		},
+		{
+			operator:  FILTER_NOT_IN,
+			input:     "1",
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_NOT_IN, Values: []interface{}{"1"}},
+		},
+		{
+			operator:  FILTER_IS_NULL,
+			input:     "true",
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_IS_NULL},
+		},
+		{
+			operator:  FILTER_IS_NULL,
+			input:     "false",
+			predicate: surf.Predicate{Field: "field", PredicateType: surf.WHERE_IS_NOT_NULL},
+		},
+		{operator: FILTER_IN, input: `a\b`, fails: true},
+		{operator: FILTER_NOT_IN, input: `a\`, fails: true},
+		{operator: FILTER_IS_NULL, input: "yes", fails: true},
+		{operator: FILTER_IS_NULL, input: "", fails: true},
+		{operator: "unknown", input: "5", fails: true},
+	}
+
+	for _, test := range tests {
+		predicate, err := filterPredicate("filter[field]["+test.operator+"]", "field", test.operator, test.input)
+		if test.fails {
+			if err == nil {
+				t.Errorf("Expected operator %q with input %q to fail, got %+v", test.operator, test.input, predicate)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for operator %q with input %q: %v", test.operator, test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(predicate, test.predicate) {
+			t.Errorf("Operator %q with input %q gave %+v, expected %+v", test.operator, test.input, predicate, test.predicate)
+		}
+	}
+}
+
+func TestGetFilterPredicates(t *testing.T) {
+	tests := []struct {
+		query      string
+		whiteList  []string
+		disabled   bool
+		predicates []surf.Predicate
+		fails      bool
+	}{
+		{
+			query: "",
+		},
+		{
+			query: "limit=5&sort=name",
+		},
+		{
+			query: "filter[name]=a&filter[id][gt]=5",
+			predicates: []surf.Predicate{
+				{Field: "id", PredicateType: surf.WHERE_GREATER_THAN, Values: []interface{}{"5"}},
+				{Field: "name", PredicateType: surf.WHERE_EQUAL, Values: []interface{}{"a"}},
+			},
+		},
+		{
+			query: "filter[name][ne]=a&filter[name][ne]=b",
+			predicates: []surf.Predicate{
+				{Field: "name", PredicateType: surf.WHERE_NOT_EQUAL, Values: []interface{}{"a"}},
+				{Field: "name", PredicateType: surf.WHERE_NOT_EQUAL, Values: []interface{}{"b"}},
+			},
+		},
+		{
+			query:     "filter[name]=a",
+			whiteList: []string{"name"},
+			predicates: []surf.Predicate{
+				{Field: "name", PredicateType: surf.WHERE_EQUAL, Values: []interface{}{"a"}},
+			},
+		},
+		{
+			query:     "filter[password]=a",
+			whiteList: []string{"password"},
+			predicates: []surf.Predicate{
+				{Field: "password", PredicateType: surf.WHERE_EQUAL, Values: []interface{}{"a"}},
+			},
+		},
+		{query: "filter[unknown]=a", fails: true},
+		{query: "filter[password]=a", fails: true},
+		{query: "filter[display_name]=a", fails: true},
+		{query: "filter[unknown]=a", whiteList: []string{"unknown"}, fails: true},
+		{query: "filter[id]=5", whiteList: []string{"name"}, fails: true},
+		{query: "limit=5", disabled: true},
+		{query: "filter[name]=a", disabled: true, fails: true},
+		{query: "filter[name]=a", whiteList: []string{"name"}, disabled: true, fails: true},
+		{query: "filter[name][between]=a", fails: true},
+		{query: "filter[name=a", fails: true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/authors?"+url.PathEscape(test.query), nil)
+		predicates, err := getFilterPredicates(r, &testAuthor{}, test.whiteList, test.disabled)
+		if test.fails {
+			if err == nil {
+				t.Errorf("Expected %q to fail, got %+v", test.query, predicates)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", test.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(predicates, test.predicates) {
+			t.Errorf("%q gave %+v, expected %+v", test.query, predicates, test.predicates)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/go-carrot/surf"
+	"github.com/go-carrot/validator"
+)
+
+// Includable is implemented by controllers whose models can be embedded in the
+// responses of another controller with the `include` parameter.
+//
+// OneToOneController, OneToManyController and ManyToManyController are all
+// Includable, using the same foreign references they are configured with.
+type Includable interface {
+	// IncludeName is the value of the `include` parameter that embeds these models
+	IncludeName() string
+
+	// IncludeFields are the fields of the base model needed to load the include
+	IncludeFields() []string
+
+	// LoadIncludes loads the included models of each base model, in the same order as baseModels
+	LoadIncludes(baseModels []surf.Model) ([]interface{}, error)
+}
+
+func includeValue(output *string, includes []Includable, r *http.Request) *validator.Value {
+	return &validator.Value{
+		Result: output,
+		Name:   "include",
+		Input:  r.URL.Query().Get("include"),
+		Rules:  []validator.Rule{validateIncludeField(includes)},
+	}
+}
+
+func validateIncludeField(includes []Includable) func(name, input string) error {
+	return func(name string, input string) error {
+		if input == "" {
+			return nil
+		}
+	Includes:
+		for _, inputInclude := range strings.Split(input, ",") {
+			for _, include := range includes {
+				if inputInclude == include.IncludeName() {
+					continue Includes
+				}
+			}
+			return fmt.Errorf("Parameter '%v' must only contain includes supported by the model. Input '%v' is invalid.", name, inputInclude)
+		}
+		return nil
+	}
+}
+
+// requestedIncludes returns the includes named in the validated `include` parameter
+func requestedIncludes(input string, includes []Includable) []Includable {
+	if input == "" {
+		return nil
+	}
+	var requested []Includable
+	names := strings.Split(input, ",")
+	for _, include := range includes {
+		if contains(names, include.IncludeName()) {
+			requested = append(requested, include)
+		}
+	}
+	return requested
+}
+
+// includeFields returns every base model field the includes need
+func includeFields(includes []Includable) []string {
+	var fields []string
+	for _, include := range includes {
+		fields = append(fields, include.IncludeFields()...)
+	}
+	return fields
+}
+
+// embedIncludes loads the includes of each model, and returns the output of each
+// model with its includes embedded.  Returns the output unchanged if there are no includes.
+func embedIncludes(models []surf.Model, output interface{}, fields []string, includes []Includable) (interface{}, error) {
+	if len(includes) == 0 {
+		return output, nil
+	}
+
+	// Build the document of each model
+	documents := make([]map[string]interface{}, len(models))
+	for i, model := range models {
+		document, err := outputDocument(model, fields)
+		if err != nil {
+			return nil, err
+		}
+		documents[i] = document
+	}
+
+	// Embed each include
+	for _, include := range includes {
+		included, err := include.LoadIncludes(models)
+		if err != nil {
+			return nil, err
+		}
+		for i := range documents {
+			documents[i][include.IncludeName()] = included[i]
+		}
+	}
+	return documents, nil
+}
+
+// embedModelIncludes is embedIncludes for a single model
+func embedModelIncludes(model surf.Model, output interface{}, fields []string, includes []Includable) (interface{}, error) {
+	if len(includes) == 0 {
+		return output, nil
+	}
+	documents, err := embedIncludes([]surf.Model{model}, output, fields, includes)
+	if err != nil {
+		return nil, err
+	}
+	return documents.([]map[string]interface{})[0], nil
+}
+
+// outputDocument returns the output of a model as a document, so other models
+// can be embedded in it
+func outputDocument(model surf.Model, fields []string) (map[string]interface{}, error) {
+	if fields != nil {
+		return sparseFields(model, fields)
+	}
+	raw, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	var rawDocument map[string]json.RawMessage
+	err = json.Unmarshal(raw, &rawDocument)
+	if err != nil {
+		return nil, err
+	}
+	document := map[string]interface{}{}
+	for key, value := range rawDocument {
+		document[key] = value
+	}
+	return document, nil
+}
+
+// fetchByField loads every model where field is one of values
+func fetchByField(buildModel surf.BuildModel, field string, values []interface{}, predicates ...surf.Predicate) ([]surf.Model, error) {
+	if len(values) == 0 {
+		return []surf.Model{}, nil
+	}
+	return buildModel().BulkFetch(surf.BulkFetchConfig{
+		Limit: int(math.MaxInt32),
+		Predicates: append([]surf.Predicate{{
+			Field:         field,
+			PredicateType: surf.WHERE_IN,
+			Values:        values,
+		}}, predicates...),
+	}, buildModel)
+}
+
+// uniqueFieldValues returns the distinct non-null values of a field across models
+func uniqueFieldValues(models []surf.Model, name string) []interface{} {
+	seen := map[string]bool{}
+	var values []interface{}
+	for _, model := range models {
+		value, ok := fieldValue(model, name)
+		key := fmt.Sprint(value)
+		if ok && !seen[key] {
+			seen[key] = true
+			values = append(values, value)
+		}
+	}
+	return values
+}
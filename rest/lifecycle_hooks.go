@@ -45,4 +45,10 @@ type LifecycleHooks struct {
 
 	// After the model has been deleted, but before the HTTP response
 	AfterDelete AfterDeleteLifecycleHook
+
+	// After the soft deleted model has been loaded, but before it is restored
+	BeforeRestore BaseLifecycleHook
+
+	// After the model has been restored, but before the HTTP response
+	AfterRestore BaseLifecycleHook
 }
@@ -1,16 +1,21 @@
 package rest
 
 import (
-	"math"
+	"database/sql"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-carrot/response"
 	"github.com/go-carrot/surf"
 	"github.com/go-carrot/turf"
 	"github.com/go-carrot/validator"
-	"github.com/julienschmidt/httprouter"
 )
 
+// replaceBatchSize is the number of relations Replace loads at a time, when the
+// lifecycle hooks need each relation it deletes
+const replaceBatchSize = 500
+
 type ManyToManyController struct {
 	GetBaseModel                surf.BuildModel
 	GetNestedModel              surf.BuildModel
@@ -19,67 +24,218 @@ type ManyToManyController struct {
 	NestedModelForeignReference string
 	LifecycleHooks              LifecycleHooks
 	MethodWhiteList             []string
+	FullReplace                 bool
+	RelationKey                 string
+	Database                    *sql.DB
+	FilterWhiteList             []string
+	DisableFilters              bool
+	CursorPagination            bool
+	TotalCount                  bool
+	BaseModelFields             ModelFields
+	NestedModelFields           ModelFields
+	RegisterReverse             bool
+	ReverseFilterWhiteList      []string
+	ReverseDisableFilters       bool
+	IdempotentCreate            bool
+	SoftDelete                  bool
+	ReverseSoftDelete           bool
+	SoftDeleteRelations         bool
+	RelationModelFields         ModelFields
+	CanIncludeDeleted           func(r *http.Request) bool
 }
 
-func (c ManyToManyController) Register(r *httprouter.Router, mw turf.Middleware) {
+func (c ManyToManyController) Register(r turf.Router, mw turf.Middleware) {
 	baseModelTableName := c.GetBaseModel().GetConfiguration().TableName
 	nestedModelTableName := c.GetNestedModel().GetConfiguration().TableName
 	hasWhitelist := len(c.MethodWhiteList) != 0
 
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.CREATE) {
-		r.HandlerFunc(
+		turf.Handle(
+			r,
+			turf.CREATE,
 			http.MethodPost,
 			"/"+baseModelTableName+"/:id/"+nestedModelTableName+"/:nested_id",
 			mw(c.Create),
 		)
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.INDEX) {
-		r.HandlerFunc(
+		validateRelatedFetch(nestedModelTableName, c.GetNestedModel(), c.TotalCount, c.Database)
+		turf.Handle(
+			r,
+			turf.INDEX,
 			http.MethodGet,
 			"/"+baseModelTableName+"/:id/"+nestedModelTableName,
 			mw(c.Index),
 		)
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.SHOW) {
-		r.HandlerFunc(
+		turf.Handle(
+			r,
+			turf.SHOW,
 			http.MethodGet,
 			"/"+baseModelTableName+"/:id/"+nestedModelTableName+"/:nested_id",
 			mw(c.Show),
 		)
 	}
+	if !hasWhitelist || contains(c.MethodWhiteList, turf.UPDATE) {
+		turf.Handle(
+			r,
+			turf.UPDATE,
+			http.MethodPut,
+			"/"+baseModelTableName+"/:id/"+nestedModelTableName+"/:nested_id",
+			mw(c.Update),
+		)
+	}
+	if !hasWhitelist || contains(c.MethodWhiteList, turf.PATCH) {
+		turf.Handle(
+			r,
+			turf.PATCH,
+			http.MethodPatch,
+			"/"+baseModelTableName+"/:id/"+nestedModelTableName+"/:nested_id",
+			mw(c.Patch),
+		)
+	}
+	if !hasWhitelist || contains(c.MethodWhiteList, turf.REPLACE) {
+		turf.Handle(
+			r,
+			turf.REPLACE,
+			http.MethodPut,
+			"/"+baseModelTableName+"/:id/"+nestedModelTableName,
+			mw(c.Replace),
+		)
+	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.DELETE) {
-		r.HandlerFunc(
+		turf.Handle(
+			r,
+			turf.DELETE,
 			http.MethodDelete,
 			"/"+baseModelTableName+"/:id/"+nestedModelTableName+"/:nested_id",
 			mw(c.Delete),
 		)
 	}
+	if c.RegisterReverse {
+		c.Reverse().Register(r, mw)
+	}
+}
+
+// Reverse returns the controller for the other direction of the relation, where
+// the nested model is the base model (`/tags/:id/posts` for `/posts/:id/tags`).
+//
+// The Create, Update and Delete lifecycle hooks are shared, as they receive the
+// relation model in both directions.  The Index and Show hooks apply to the nested
+// model, so they are not shared.  The ReverseFilterWhiteList, ReverseDisableFilters
+// and ReverseSoftDelete are the FilterWhiteList, DisableFilters and SoftDelete of the
+// reversed controller, and work the same way as on this one.
+func (c ManyToManyController) Reverse() ManyToManyController {
+	return ManyToManyController{
+		GetBaseModel:                c.GetNestedModel,
+		GetNestedModel:              c.GetBaseModel,
+		GetRelationModel:            c.GetRelationModel,
+		BaseModelForeignReference:   c.NestedModelForeignReference,
+		NestedModelForeignReference: c.BaseModelForeignReference,
+		LifecycleHooks: LifecycleHooks{
+			BeforeCreate: c.LifecycleHooks.BeforeCreate,
+			AfterCreate:  c.LifecycleHooks.AfterCreate,
+			BeforeUpdate: c.LifecycleHooks.BeforeUpdate,
+			AfterUpdate:  c.LifecycleHooks.AfterUpdate,
+			BeforeDelete: c.LifecycleHooks.BeforeDelete,
+			AfterDelete:  c.LifecycleHooks.AfterDelete,
+		},
+		MethodWhiteList:        c.MethodWhiteList,
+		FullReplace:            c.FullReplace,
+		IdempotentCreate:       c.IdempotentCreate,
+		RelationKey:            c.RelationKey,
+		Database:               c.Database,
+		FilterWhiteList:        c.ReverseFilterWhiteList,
+		DisableFilters:         c.ReverseDisableFilters,
+		ReverseFilterWhiteList: c.FilterWhiteList,
+		ReverseDisableFilters:  c.DisableFilters,
+		CursorPagination:       c.CursorPagination,
+		TotalCount:             c.TotalCount,
+		BaseModelFields:        c.NestedModelFields,
+		NestedModelFields:      c.BaseModelFields,
+		SoftDelete:             c.ReverseSoftDelete,
+		ReverseSoftDelete:      c.SoftDelete,
+		SoftDeleteRelations:    c.SoftDeleteRelations,
+		RelationModelFields:    c.RelationModelFields,
+		CanIncludeDeleted:      c.CanIncludeDeleted,
+	}
 }
 
 func (c ManyToManyController) Create(w http.ResponseWriter, r *http.Request) {
 	resp := response.New(w)
 	defer resp.Output()
 
-	// Validate Params
-	var id, nestedId int64
-	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
-		nestedModelIdValue(&nestedId, r),
-	})
+	// Create relation model
+	relationModel := c.GetRelationModel()
+
+	// Generate values to be tested
+	values, err := getInsertValues(r, relationModel, c.BaseModelForeignReference, c.NestedModelForeignReference)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(bodyErrorStatus(err), nil)
+		return
+	}
+	baseModel := c.GetBaseModel()
+	nestedModel := c.GetNestedModel()
+	values = append(values,
+		baseModelIdValue(baseModel, c.BaseModelFields, r),
+		nestedModelIdValue(nestedModel, c.NestedModelFields, r),
+	)
+
+	// Test values
+	err = validator.Validate(values)
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
 		resp.SetResult(http.StatusBadRequest, nil)
 		return
 	}
 
-	// Prep relation model
-	relationModel := c.GetRelationModel()
-	for _, field := range relationModel.GetConfiguration().Fields {
-		if field.Name == c.BaseModelForeignReference {
-			*field.Pointer.(*int64) = id
-		} else if field.Name == c.NestedModelForeignReference {
-			*field.Pointer.(*int64) = nestedId
+	// Verify both models exist
+	id, _ := fieldValue(baseModel, c.BaseModelFields.idField())
+	nestedId, _ := fieldValue(nestedModel, c.NestedModelFields.idField())
+	err = baseModel.Load()
+	if err != nil {
+		resp.SetErrorDetails(fmt.Sprintf("%v '%v' was not found.", baseModel.GetConfiguration().TableName, id))
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+	err = loadModel(r, nestedModel, c.NestedModelFields, c.SoftDelete)
+	if err != nil {
+		resp.SetErrorDetails(fmt.Sprintf("%v '%v' was not found.", nestedModel.GetConfiguration().TableName, nestedId))
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Make sure the relation doesn't already exist
+	relations, err := c.GetRelationModel().BulkFetch(surf.BulkFetchConfig{
+		Limit:      1,
+		Predicates: c.relationIdPredicates(id, nestedId),
+	}, c.GetRelationModel)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if len(relations) > 0 {
+		if c.IdempotentCreate {
+			resp.SetResult(http.StatusOK, relations[0])
+			return
 		}
+		resp.SetErrorDetails(fmt.Sprintf("%v '%v' is already related to %v '%v'.", baseModel.GetConfiguration().TableName, id, nestedModel.GetConfiguration().TableName, nestedId))
+		resp.SetResult(http.StatusConflict, nil)
+		return
+	}
+
+	// Set foreign references
+	err = setFieldValue(relationModel, c.BaseModelForeignReference, id)
+	if err == nil {
+		err = setFieldValue(relationModel, c.NestedModelForeignReference, nestedId)
+	}
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
 
 	// Before Create hook
@@ -106,23 +262,25 @@ func (c ManyToManyController) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// OK
-	resp.SetResult(http.StatusOK, nil)
+	resp.SetResult(http.StatusOK, relationModel)
 }
 
 func (c ManyToManyController) Index(w http.ResponseWriter, r *http.Request) {
-	// TODO, this can be more efficient with an IN predicate with a sub query
 	resp := response.New(w)
 	defer resp.Output()
 
 	// Validate Params
-	var id int64
+	baseModel := c.GetBaseModel()
 	var limit, offset int
-	var sort string
+	var sort, fields string
+	var includeDeleted bool
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
+		baseModelIdValue(baseModel, c.BaseModelFields, r),
 		defaultLimitValue(&limit, r),
 		defaultOffsetValue(&offset, r),
-		defaultSortValue(&sort, c.GetNestedModel().GetConfiguration(), r),
+		defaultSortValue(&sort, c.GetNestedModel().GetConfiguration(), c.NestedModelFields, r),
+		fieldsValue(&fields, c.GetNestedModel().GetConfiguration().TableName, c.GetNestedModel(), r),
+		includeDeletedValue(&includeDeleted, c.CanIncludeDeleted, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -130,61 +288,45 @@ func (c ManyToManyController) Index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify base model exists
-	baseModel := c.GetBaseModel()
-	for _, field := range baseModel.GetConfiguration().Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
+	// Parse cursor
+	var requestCursor *cursor
+	if c.CursorPagination {
+		requestCursor, err = parseCursor(r, c.GetNestedModel().GetConfiguration(), c.NestedModelFields.idField(), sort)
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusBadRequest, nil)
+			return
 		}
 	}
+
+	// Verify base model exists
 	err = baseModel.Load()
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
 
-	// Load relations
-	relations, err := c.GetRelationModel().BulkFetch(surf.BulkFetchConfig{
-		Limit: int(math.MaxInt32),
-		Predicates: []surf.Predicate{{
-			Field:         c.BaseModelForeignReference,
-			PredicateType: surf.WHERE_EQUAL,
-			Values:        []interface{}{id},
-		}},
-	}, c.GetRelationModel)
-	if err != nil {
-		resp.SetErrorDetails(err.Error())
-		resp.SetResult(http.StatusInternalServerError, nil)
-		return
-	}
-	if len(relations) == 0 {
-		resp.SetResult(http.StatusOK, make([]interface{}, 0))
-		return
-	}
-
-	// Get all the IDs
-	ids := make([]interface{}, 0)
-	for _, r := range relations {
-		for _, field := range r.GetConfiguration().Fields {
-			if field.Name == c.NestedModelForeignReference {
-				ids = append(ids, *(field.Pointer.(*int64)))
-			}
-		}
-	}
-
 	// Prepare BulkFetchConfig
 	fetchConfig := surf.BulkFetchConfig{
 		Limit:  limit,
 		Offset: offset,
-		Predicates: []surf.Predicate{{
-			Field:         "id",
-			PredicateType: surf.WHERE_IN,
-			Values:        ids,
-		}},
 	}
 	fetchConfig.ConsumeSortQuery(sort)
-	applyModSinceHeader(&fetchConfig, r)
+	applyModSinceHeader(&fetchConfig, c.NestedModelFields, r)
+
+	// Consume filter query
+	filterPredicates, err := getFilterPredicates(r, c.GetNestedModel(), c.FilterWhiteList, c.DisableFilters)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusBadRequest, nil)
+		return
+	}
+	fetchConfig.Predicates = append(fetchConfig.Predicates, filterPredicates...)
+
+	// Exclude soft deleted models
+	if c.SoftDelete && !includeDeleted {
+		fetchConfig.Predicates = append(fetchConfig.Predicates, notDeletedPredicate(c.NestedModelFields))
+	}
 
 	// Before Index hook
 	if c.LifecycleHooks.BeforeIndex != nil {
@@ -194,14 +336,51 @@ func (c ManyToManyController) Index(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Only fetch the nested models related to the base model
+	id, _ := fieldValue(baseModel, c.BaseModelFields.idField())
+	relation := Relation{
+		TableName:  c.GetRelationModel().GetConfiguration().TableName,
+		Field:      c.NestedModelForeignReference,
+		Predicates: c.baseRelationPredicates(id),
+	}
+	buildModel := relatedBuildModel(
+		selectingModel(c.GetNestedModel, c.NestedModelFields.idField(), splitFields(fields), fetchConfig, c.NestedModelFields.modifiedAtField()),
+		c.NestedModelFields.idField(),
+		relation,
+		c.Database,
+	)
+
 	// Load nested models
-	nestedModels, err := c.GetNestedModel().BulkFetch(fetchConfig, c.GetNestedModel)
+	var nestedModels []surf.Model
+	if c.CursorPagination {
+		nestedModels, err = fetchCursorPage(w, r, buildModel, c.NestedModelFields.idField(), fetchConfig, requestCursor, sort)
+	} else {
+		nestedModels, err = buildModel().BulkFetch(fetchConfig, buildModel)
+	}
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
 		resp.SetResult(http.StatusInternalServerError, nil)
 		return
 	}
 
+	// Set Last-Modified header
+	setLastModifiedHeader(w, c.NestedModelFields, nestedModels...)
+
+	// Set pagination headers
+	total := int64(-1)
+	if c.TotalCount {
+		total, err = countModels(buildModel(), fetchConfig, c.Database)
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusInternalServerError, nil)
+			return
+		}
+		setTotalCountHeader(w, total)
+	}
+	if !c.CursorPagination {
+		setOffsetLinkHeader(w, r, fetchConfig, sort, len(nestedModels), total)
+	}
+
 	// After Index hook
 	if c.LifecycleHooks.AfterIndex != nil {
 		err := c.LifecycleHooks.AfterIndex(resp, r, &nestedModels)
@@ -210,8 +389,16 @@ func (c ManyToManyController) Index(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Select fields
+	output, err := sparseModels(nestedModels, splitFields(fields))
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
 	// OK
-	resp.SetResult(http.StatusOK, nestedModels)
+	resp.SetResult(http.StatusOK, output)
 }
 
 func (c ManyToManyController) Show(w http.ResponseWriter, r *http.Request) {
@@ -219,10 +406,15 @@ func (c ManyToManyController) Show(w http.ResponseWriter, r *http.Request) {
 	defer resp.Output()
 
 	// Validate Params
-	var id, nestedId int64
+	baseModel := c.GetBaseModel()
+	nestedModel := c.GetNestedModel()
+	var fields string
+	var includeDeleted bool
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
-		nestedModelIdValue(&nestedId, r),
+		baseModelIdValue(baseModel, c.BaseModelFields, r),
+		nestedModelIdValue(nestedModel, c.NestedModelFields, r),
+		fieldsValue(&fields, c.GetNestedModel().GetConfiguration().TableName, c.GetNestedModel(), r),
+		includeDeletedValue(&includeDeleted, c.CanIncludeDeleted, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -231,35 +423,21 @@ func (c ManyToManyController) Show(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify the relation exists
+	relationPredicates := c.relationPredicates(baseModel, nestedModel)
 	relations, err := c.GetRelationModel().BulkFetch(surf.BulkFetchConfig{
-		Limit: 1,
-		Predicates: []surf.Predicate{
-			{
-				Field:         c.BaseModelForeignReference,
-				PredicateType: surf.WHERE_EQUAL,
-				Values:        []interface{}{id},
-			},
-			{
-				Field:         c.NestedModelForeignReference,
-				PredicateType: surf.WHERE_EQUAL,
-				Values:        []interface{}{nestedId},
-			},
-		},
+		Limit:      1,
+		Predicates: relationPredicates,
 	}, c.GetRelationModel)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
 	if len(relations) < 1 {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
 
-	// Set ID
-	nestedModel := c.GetNestedModel()
-	for _, field := range nestedModel.GetConfiguration().Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = nestedId
-			break
-		}
-	}
-
 	// Before Show hook
 	if c.LifecycleHooks.BeforeShow != nil {
 		err := c.LifecycleHooks.BeforeShow(resp, r, nestedModel)
@@ -269,7 +447,11 @@ func (c ManyToManyController) Show(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Load nested model
-	err = nestedModel.Load()
+	err = loadModel(r, nestedModel, c.NestedModelFields, c.SoftDelete && !includeDeleted)
+	if err == sql.ErrNoRows {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
 		resp.SetResult(http.StatusInternalServerError, nil)
@@ -284,16 +466,173 @@ func (c ManyToManyController) Show(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Check `If-None-Match` header
+	etag, err := relatedETag(relations[0], nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if !isNoneMatchHeader(etag, r) {
+		resp.SetResult(http.StatusNotModified, nil)
+		return
+	}
+
+	// Check `If-Modified-Since` header
+	setLastModifiedHeader(w, c.NestedModelFields, nestedModel)
+	if !isModifiedSinceHeader(nestedModel, c.NestedModelFields, r) {
+		resp.SetResult(http.StatusNotModified, nil)
+		return
+	}
+
+	// Select fields
+	output, err := sparseModel(nestedModel, splitFields(fields))
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Embed relation
+	if c.RelationKey != "" {
+		document, err := outputDocument(nestedModel, splitFields(fields))
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusInternalServerError, nil)
+			return
+		}
+		document[c.RelationKey] = relations[0]
+		output = document
+	}
+
 	// OK
-	resp.SetResult(http.StatusOK, nestedModel)
+	resp.SetResult(http.StatusOK, output)
 }
 
 func (c ManyToManyController) Update(w http.ResponseWriter, r *http.Request) {
+	if c.FullReplace {
+		c.update(w, r, getReplaceValues)
+	} else {
+		c.update(w, r, getUpdateValues)
+	}
+}
+
+func (c ManyToManyController) Patch(w http.ResponseWriter, r *http.Request) {
+	if !isPatchRequest(r) {
+		writeUnsupportedPatchType(w)
+		return
+	}
+	c.update(w, r, getPatchValues)
+}
+
+func (c ManyToManyController) update(w http.ResponseWriter, r *http.Request, getValues valuesGenerator) {
 	resp := response.New(w)
 	defer resp.Output()
 
-	// There is no update for a many:many model
-	resp.SetResult(http.StatusMethodNotAllowed, nil)
+	// Validate Params
+	baseModel := c.GetBaseModel()
+	nestedModel := c.GetNestedModel()
+	err := validator.Validate([]*validator.Value{
+		baseModelIdValue(baseModel, c.BaseModelFields, r),
+		nestedModelIdValue(nestedModel, c.NestedModelFields, r),
+	})
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusBadRequest, nil)
+		return
+	}
+
+	// Load relation
+	relationPredicates := c.relationPredicates(baseModel, nestedModel)
+	relations, err := c.GetRelationModel().BulkFetch(surf.BulkFetchConfig{
+		Limit:      1,
+		Predicates: relationPredicates,
+	}, c.GetRelationModel)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if len(relations) < 1 {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+	relation := relations[0]
+
+	// Load nested model
+	err = nestedModel.Load()
+	if err == sql.ErrNoRows {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Check `If-Match` and `If-None-Match` headers
+	etag, err := relatedETag(relation, nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if !isMatchHeader(etag, r) || !isNoneMatchHeader(etag, r) {
+		resp.SetErrorDetails("The `If-Match` or `If-None-Match` condition is not satisfied")
+		resp.SetResult(http.StatusPreconditionFailed, nil)
+		return
+	}
+
+	// Generate + test values
+	values, err := getValues(r, relation, c.BaseModelForeignReference, c.NestedModelForeignReference)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(bodyErrorStatus(err), nil)
+		return
+	}
+	err = validator.Validate(values)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusBadRequest, nil)
+		return
+	}
+
+	// Before Update hook
+	if c.LifecycleHooks.BeforeUpdate != nil {
+		err := c.LifecycleHooks.BeforeUpdate(resp, r, relation)
+		if err != nil {
+			return
+		}
+	}
+
+	// Update
+	err = updateRelation(r, relation, c.GetRelationModel, relationPredicates)
+	if err != nil {
+		handleInsertUpdateError(resp, err)
+		return
+	}
+
+	// After Update hook
+	if c.LifecycleHooks.AfterUpdate != nil {
+		err := c.LifecycleHooks.AfterUpdate(resp, r, relation)
+		if err != nil {
+			return
+		}
+	}
+
+	// Set ETag header
+	etag, err = relatedETag(relation, nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	w.Header().Set("ETag", etag)
+
+	// OK
+	resp.SetResult(http.StatusOK, relation)
 }
 
 func (c ManyToManyController) Delete(w http.ResponseWriter, r *http.Request) {
@@ -301,10 +640,11 @@ func (c ManyToManyController) Delete(w http.ResponseWriter, r *http.Request) {
 	defer resp.Output()
 
 	// Validate Params
-	var id, nestedId int64
+	baseModel := c.GetBaseModel()
+	nestedModel := c.GetNestedModel()
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
-		nestedModelIdValue(&nestedId, r),
+		baseModelIdValue(baseModel, c.BaseModelFields, r),
+		nestedModelIdValue(nestedModel, c.NestedModelFields, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -313,21 +653,16 @@ func (c ManyToManyController) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify the relation exists
+	relationPredicates := c.relationPredicates(baseModel, nestedModel)
 	relations, err := c.GetRelationModel().BulkFetch(surf.BulkFetchConfig{
-		Limit: 1,
-		Predicates: []surf.Predicate{
-			{
-				Field:         c.BaseModelForeignReference,
-				PredicateType: surf.WHERE_EQUAL,
-				Values:        []interface{}{id},
-			},
-			{
-				Field:         c.NestedModelForeignReference,
-				PredicateType: surf.WHERE_EQUAL,
-				Values:        []interface{}{nestedId},
-			},
-		},
+		Limit:      1,
+		Predicates: relationPredicates,
 	}, c.GetRelationModel)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
 	if len(relations) < 1 {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
@@ -336,6 +671,31 @@ func (c ManyToManyController) Delete(w http.ResponseWriter, r *http.Request) {
 	// Get relation
 	relation := relations[0]
 
+	// Load nested model
+	err = nestedModel.Load()
+	if err == sql.ErrNoRows {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Check `If-Match` and `If-None-Match` headers
+	etag, err := relatedETag(relation, nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if !isMatchHeader(etag, r) || !isNoneMatchHeader(etag, r) {
+		resp.SetErrorDetails("The `If-Match` or `If-None-Match` condition is not satisfied")
+		resp.SetResult(http.StatusPreconditionFailed, nil)
+		return
+	}
+
 	// Before Delete hook
 	if c.LifecycleHooks.BeforeDelete != nil {
 		err := c.LifecycleHooks.BeforeDelete(resp, r, relation)
@@ -345,7 +705,7 @@ func (c ManyToManyController) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete relation
-	err = relation.Delete()
+	err = c.removeRelation(r, relation, relationPredicates)
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
 		resp.SetResult(http.StatusInternalServerError, nil)
@@ -363,3 +723,341 @@ func (c ManyToManyController) Delete(w http.ResponseWriter, r *http.Request) {
 	// OK
 	resp.SetResult(http.StatusOK, nil)
 }
+
+// Replace replaces every relation of a base model with relations to the nested
+// models in the `ids` parameter, inserting and deleting relations as needed
+// within a single transaction
+func (c ManyToManyController) Replace(w http.ResponseWriter, r *http.Request) {
+	resp := response.New(w)
+	defer resp.Output()
+
+	// Get inputs
+	inputs, err := getRequestInputs(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(bodyErrorStatus(err), nil)
+		return
+	}
+
+	// Validate Params
+	baseModel := c.GetBaseModel()
+	var nestedIds []interface{}
+	err = validator.Validate([]*validator.Value{
+		baseModelIdValue(baseModel, c.BaseModelFields, r),
+		nestedIdsValue(&nestedIds, c.GetNestedModel, c.NestedModelFields, inputs),
+	})
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusBadRequest, nil)
+		return
+	}
+
+	// Begin transaction
+	if c.Database == nil {
+		resp.SetErrorDetails("A Database must be set on the controller to replace relations within a transaction.")
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	defer rollbackTx(r)
+
+	// Verify base model exists, and lock it so concurrent replaces run one at a time
+	err = loadModel(r, baseModel, c.BaseModelFields, false)
+	if err != nil {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Verify the nested models exist
+	if len(nestedIds) > 0 {
+		fetchConfig := surf.BulkFetchConfig{
+			Limit: len(nestedIds),
+			Predicates: []surf.Predicate{{
+				Field:         c.NestedModelFields.idField(),
+				PredicateType: surf.WHERE_IN,
+				Values:        nestedIds,
+			}},
+		}
+		if c.SoftDelete {
+			fetchConfig.Predicates = append(fetchConfig.Predicates, notDeletedPredicate(c.NestedModelFields))
+		}
+		buildModel := selectingModel(c.GetNestedModel, c.NestedModelFields.idField(), []string{c.NestedModelFields.idField()}, fetchConfig)
+		nestedModel := buildModel()
+		nestedModels, err := fetchModels(r, buildModel, fetchConfig)
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusInternalServerError, nil)
+			return
+		}
+		found := map[string]bool{}
+		for _, nestedModel := range nestedModels {
+			nestedId, _ := fieldKey(nestedModel, c.NestedModelFields.idField())
+			found[nestedId] = true
+		}
+		for _, nestedId := range nestedIds {
+			if !found[fmt.Sprint(nestedId)] {
+				resp.SetErrorDetails(fmt.Sprintf("%v '%v' was not found.", nestedModel.GetConfiguration().TableName, nestedId))
+				resp.SetResult(http.StatusNotFound, nil)
+				return
+			}
+		}
+	}
+
+	// Load the relations to keep
+	id, _ := fieldValue(baseModel, c.BaseModelFields.idField())
+	var kept []surf.Model
+	if len(nestedIds) > 0 {
+		kept, err = fetchModels(r, c.GetRelationModel, surf.BulkFetchConfig{
+			Limit: len(nestedIds),
+			Predicates: append(c.baseRelationPredicates(id), surf.Predicate{
+				Field:         c.NestedModelForeignReference,
+				PredicateType: surf.WHERE_IN,
+				Values:        nestedIds,
+			}),
+		})
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusInternalServerError, nil)
+			return
+		}
+	}
+
+	// Determine which relations to insert
+	existing := map[string]bool{}
+	for _, relation := range kept {
+		nestedId, _ := fieldKey(relation, c.NestedModelForeignReference)
+		existing[nestedId] = true
+	}
+	var inserted []interface{}
+	for _, nestedId := range nestedIds {
+		key := fmt.Sprint(nestedId)
+		if !existing[key] {
+			existing[key] = true
+			inserted = append(inserted, nestedId)
+		}
+	}
+
+	// Delete every other relation in one query, unless hooks need each of them
+	deletedPredicates := append(c.baseRelationPredicates(id), surf.Predicate{
+		Field:         c.NestedModelForeignReference,
+		PredicateType: surf.WHERE_NOT_IN,
+		Values:        nestedIds,
+	})
+	hasDeleteHooks := c.LifecycleHooks.BeforeDelete != nil || c.LifecycleHooks.AfterDelete != nil
+	if !hasDeleteHooks {
+		err = c.removeRelations(r, deletedPredicates)
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusInternalServerError, nil)
+			return
+		}
+	}
+
+	// Otherwise, delete them in batches.  Deleted relations drop out of the next batch.
+	for hasDeleteHooks {
+		deleted, err := fetchModels(r, c.GetRelationModel, surf.BulkFetchConfig{
+			Limit:      replaceBatchSize,
+			Predicates: deletedPredicates,
+		})
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusInternalServerError, nil)
+			return
+		}
+		for _, relation := range deleted {
+
+			// Before Delete hook
+			if c.LifecycleHooks.BeforeDelete != nil {
+				err := c.LifecycleHooks.BeforeDelete(resp, r, relation)
+				if err != nil {
+					return
+				}
+			}
+
+			// Delete relation
+			nestedId, _ := fieldValue(relation, c.NestedModelForeignReference)
+			err = c.removeRelation(r, relation, c.relationIdPredicates(id, nestedId))
+			if err != nil {
+				resp.SetErrorDetails(err.Error())
+				resp.SetResult(http.StatusInternalServerError, nil)
+				return
+			}
+
+			// After Delete hook
+			if c.LifecycleHooks.AfterDelete != nil {
+				err := c.LifecycleHooks.AfterDelete(resp, r)
+				if err != nil {
+					return
+				}
+			}
+		}
+		if len(deleted) < replaceBatchSize {
+			break
+		}
+	}
+
+	// Insert relations
+	for _, nestedId := range inserted {
+		relation := c.GetRelationModel()
+		err = setFieldValue(relation, c.BaseModelForeignReference, id)
+		if err == nil {
+			err = setFieldValue(relation, c.NestedModelForeignReference, nestedId)
+		}
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusInternalServerError, nil)
+			return
+		}
+
+		// Before Create hook
+		if c.LifecycleHooks.BeforeCreate != nil {
+			err := c.LifecycleHooks.BeforeCreate(resp, r, relation)
+			if err != nil {
+				return
+			}
+		}
+
+		// Insert relation
+		err = insertModel(r, relation)
+		if err != nil {
+			handleInsertUpdateError(resp, err)
+			return
+		}
+
+		// After Create hook
+		if c.LifecycleHooks.AfterCreate != nil {
+			err := c.LifecycleHooks.AfterCreate(resp, r, relation)
+			if err != nil {
+				return
+			}
+		}
+		kept = append(kept, relation)
+	}
+
+	// Commit
+	err = commitTx(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// OK
+	if kept == nil {
+		kept = []surf.Model{}
+	}
+	resp.SetResult(http.StatusOK, kept)
+}
+
+// relationPredicates matches the relation between a base model and a nested model
+// by its foreign references, so relations don't need a unique identifier
+func (c ManyToManyController) relationPredicates(baseModel, nestedModel surf.Model) []surf.Predicate {
+	id, _ := fieldValue(baseModel, c.BaseModelFields.idField())
+	nestedId, _ := fieldValue(nestedModel, c.NestedModelFields.idField())
+	return c.relationIdPredicates(id, nestedId)
+}
+
+// relationIdPredicates matches the relation between the ids of a base model and a nested model
+func (c ManyToManyController) relationIdPredicates(id, nestedId interface{}) []surf.Predicate {
+	return append(c.baseRelationPredicates(id), surf.Predicate{
+		Field:         c.NestedModelForeignReference,
+		PredicateType: surf.WHERE_EQUAL,
+		Values:        []interface{}{nestedId},
+	})
+}
+
+// baseRelationPredicates matches the relations of the id of a base model.  With
+// SoftDeleteRelations set, soft deleted relations are left out.
+func (c ManyToManyController) baseRelationPredicates(id interface{}) []surf.Predicate {
+	predicates := []surf.Predicate{{
+		Field:         c.BaseModelForeignReference,
+		PredicateType: surf.WHERE_EQUAL,
+		Values:        []interface{}{id},
+	}}
+	if c.SoftDeleteRelations {
+		predicates = append(predicates, notDeletedPredicate(c.RelationModelFields))
+	}
+	return predicates
+}
+
+// removeRelation deletes a relation matched by predicates, or marks it as deleted
+// with SoftDeleteRelations set
+func (c ManyToManyController) removeRelation(r *http.Request, relation surf.Model, predicates []surf.Predicate) error {
+	if !c.SoftDeleteRelations {
+		return deleteRelation(r, relation, c.GetRelationModel, predicates)
+	}
+	err := setFieldValue(relation, c.RelationModelFields.deletedAtField(), time.Now())
+	if err != nil {
+		return err
+	}
+	return updateRelation(r, relation, c.GetRelationModel, predicates)
+}
+
+// removeRelations deletes every relation matching predicates in a single query, or
+// marks them as deleted with SoftDeleteRelations set
+func (c ManyToManyController) removeRelations(r *http.Request, predicates []surf.Predicate) error {
+	if !c.SoftDeleteRelations {
+		return deleteModels(r, c.GetRelationModel, predicates)
+	}
+	return softDeleteModels(r, c.GetRelationModel, c.RelationModelFields, predicates, time.Now())
+}
+
+func (c ManyToManyController) IncludeName() string {
+	return c.GetNestedModel().GetConfiguration().TableName
+}
+
+func (c ManyToManyController) IncludeFields() []string {
+	return []string{c.BaseModelFields.idField()}
+}
+
+func (c ManyToManyController) LoadIncludes(baseModels []surf.Model) ([]interface{}, error) {
+	// Load the relations of every base model, leaving out soft deleted ones
+	var relationPredicates []surf.Predicate
+	if c.SoftDeleteRelations {
+		relationPredicates = append(relationPredicates, notDeletedPredicate(c.RelationModelFields))
+	}
+	relations, err := fetchByField(c.GetRelationModel, c.BaseModelForeignReference, uniqueFieldValues(baseModels, c.BaseModelFields.idField()), relationPredicates...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load every related nested model, leaving out soft deleted ones
+	var predicates []surf.Predicate
+	if c.SoftDelete {
+		predicates = append(predicates, notDeletedPredicate(c.NestedModelFields))
+	}
+	nestedModels, err := fetchByField(c.GetNestedModel, c.NestedModelFields.idField(), uniqueFieldValues(relations, c.NestedModelForeignReference), predicates...)
+	if err != nil {
+		return nil, err
+	}
+	nestedModelsById := map[string]surf.Model{}
+	for _, nestedModel := range nestedModels {
+		id, _ := fieldKey(nestedModel, c.NestedModelFields.idField())
+		nestedModelsById[id] = nestedModel
+	}
+	nestedModelsByBaseId := map[string][]surf.Model{}
+	for _, relation := range relations {
+		baseId, _ := fieldKey(relation, c.BaseModelForeignReference)
+		nestedId, _ := fieldKey(relation, c.NestedModelForeignReference)
+		if nestedModel, found := nestedModelsById[nestedId]; found {
+			nestedModelsByBaseId[baseId] = append(nestedModelsByBaseId[baseId], nestedModel)
+		}
+	}
+
+	// Match each base model to its nested models
+	included := make([]interface{}, len(baseModels))
+	for i, baseModel := range baseModels {
+		id, _ := fieldKey(baseModel, c.BaseModelFields.idField())
+		if nestedModels, found := nestedModelsByBaseId[id]; found {
+			included[i] = nestedModels
+		} else {
+			included[i] = []surf.Model{}
+		}
+	}
+	return included, nil
+}
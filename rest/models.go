@@ -0,0 +1,184 @@
+package rest
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/go-carrot/surf"
+)
+
+// Countable is implemented by models that can count the rows matching the
+// Predicates of a BulkFetchConfig.
+//
+// Models must implement Countable for a controller with `TotalCount` set and no
+// Database.
+type Countable interface {
+	Count(bulkFetchConfig surf.BulkFetchConfig) (int64, error)
+}
+
+// BulkDeletable is implemented by models that can delete the rows matching the
+// Predicates of a BulkFetchConfig.
+//
+// Relation models without a unique identifier (join tables with a composite
+// primary key) must implement BulkDeletable to be deleted by a ManyToManyController.
+type BulkDeletable interface {
+	BulkDelete(bulkFetchConfig surf.BulkFetchConfig) error
+}
+
+// deleteRelation deletes a relation model, matched by predicates on its foreign
+// references.  Within a transaction, or when the relation implements BulkDeletable,
+// the rows matching predicates are deleted.  Otherwise, a relation with a unique
+// identifier is looked up by predicates and deleted directly.
+func deleteRelation(r *http.Request, relation surf.Model, getRelationModel surf.BuildModel, predicates []surf.Predicate) error {
+	if _, isDeletable := relation.(BulkDeletable); !isDeletable && Tx(r) == nil {
+		identified, err := identifyRelation(relation, getRelationModel, predicates)
+		if err != nil {
+			return err
+		}
+		if identified {
+			return relation.Delete()
+		}
+	}
+	return deleteModels(r, func() surf.Model {
+		return relation
+	}, predicates)
+}
+
+// BulkUpdatable is implemented by models that can update the rows matching the
+// Predicates of a BulkFetchConfig to the updatable values of the model.
+//
+// Relation models without a unique identifier must implement BulkUpdatable to
+// be updated by a ManyToManyController.
+type BulkUpdatable interface {
+	BulkUpdate(bulkFetchConfig surf.BulkFetchConfig) error
+}
+
+// updateRelation updates a relation model, matched by predicates on its foreign
+// references.  Within a transaction, or when the relation implements BulkUpdatable,
+// the rows matching predicates are updated.  Otherwise, a relation with a unique
+// identifier is looked up by predicates and updated directly.
+func updateRelation(r *http.Request, relation surf.Model, getRelationModel surf.BuildModel, predicates []surf.Predicate) error {
+	if _, isUpdatable := relation.(BulkUpdatable); !isUpdatable && Tx(r) == nil {
+		identified, err := identifyRelation(relation, getRelationModel, predicates)
+		if err != nil {
+			return err
+		}
+		if identified {
+			return relation.Update()
+		}
+	}
+	return updateModels(r, relation, predicates)
+}
+
+// identifyRelation sets the unique identifier of a relation to the one of the row
+// matching predicates, so a relation that wasn't loaded with its identifier still
+// targets the right row.  Returns false if the relation has no unique identifier.
+func identifyRelation(relation surf.Model, getRelationModel surf.BuildModel, predicates []surf.Predicate) (bool, error) {
+	for _, field := range relation.GetConfiguration().Fields {
+		if !field.UniqueIdentifier {
+			continue
+		}
+		relations, err := getRelationModel().BulkFetch(surf.BulkFetchConfig{
+			Limit:      1,
+			Predicates: predicates,
+		}, getRelationModel)
+		if err != nil {
+			return true, err
+		}
+		if len(relations) == 0 {
+			return true, sql.ErrNoRows
+		}
+		id, _ := fieldValue(relations[0], field.Name)
+		return true, assignFieldValue(field.Pointer, id)
+	}
+	return false, nil
+}
+
+// RelatedFetchable is implemented by models that can fetch the rows related to
+// a base model through a relation table in a single query, such as:
+//
+//	SELECT * FROM tags WHERE id IN (SELECT tag_id FROM post_tags WHERE post_id = $1) ORDER BY ... LIMIT ... OFFSET ...
+//
+// The Predicates of relation apply to the relation table, while the rest of
+// bulkFetchConfig applies to the model's table.  The nested model of a
+// ManyToManyController should implement RelatedFetchable, otherwise the ids of
+// every related model are loaded before each fetch.
+type RelatedFetchable interface {
+	BulkFetchRelated(relation Relation, bulkFetchConfig surf.BulkFetchConfig, buildModel surf.BuildModel) ([]surf.Model, error)
+}
+
+// RelatedCountable is implemented by models that can count the rows related to
+// a base model through a relation table in a single query, for a
+// ManyToManyController with `TotalCount` set.
+type RelatedCountable interface {
+	CountRelated(relation Relation, bulkFetchConfig surf.BulkFetchConfig) (int64, error)
+}
+
+// Versioned is implemented by models with a version field (see ModelFields) that can
+// update themselves only while their version is unchanged, incrementing it, such as:
+//
+//	UPDATE posts SET ..., version = version + 1 WHERE id = $1 AND version = $2 RETURNING version
+//
+// Models must implement Versioned when their ModelFields have a `Version` set, to be
+// updated outside of a transaction.
+type Versioned interface {
+	// UpdateVersion updates the model if its version is still the version it was
+	// loaded with, and sets the incremented version on the model.  Returns
+	// ErrVersionConflict if the version has changed.
+	UpdateVersion() error
+}
+
+// ErrVersionConflict is returned by a Versioned model when it was modified by
+// another request since it was loaded
+var ErrVersionConflict = errors.New("The model was modified since it was loaded")
+
+// ModelFields are the names of the fields of a model that controllers rely on.
+// Any field left empty uses its default.
+type ModelFields struct {
+	// Id is the unique identifier of the model.  Defaults to `id`
+	Id string
+
+	// CreatedAt is when the model was created, which is the default sort.  Defaults to `created_at`
+	CreatedAt string
+
+	// ModifiedAt is when the model was last modified, which is used by the
+	// `If-Modified-Since` and `If-Unmodified-Since` headers.  Defaults to `modified_at`
+	ModifiedAt string
+
+	// DeletedAt is when the model was soft deleted, which is used by controllers
+	// with `SoftDelete` set.  Defaults to `deleted_at`
+	DeletedAt string
+
+	// Version is incremented on every update, and is used as the `ETag` of the model.
+	// Models without a version use a hash of their content as the `ETag`.  Defaults to none
+	Version string
+}
+
+func (f ModelFields) idField() string {
+	if f.Id == "" {
+		return "id"
+	}
+	return f.Id
+}
+
+func (f ModelFields) createdAtField() string {
+	if f.CreatedAt == "" {
+		return "created_at"
+	}
+	return f.CreatedAt
+}
+
+func (f ModelFields) modifiedAtField() string {
+	if f.ModifiedAt == "" {
+		return "modified_at"
+	}
+	return f.ModifiedAt
+}
+
+func (f ModelFields) deletedAtField() string {
+	if f.DeletedAt == "" {
+		return "deleted_at"
+	}
+	return f.DeletedAt
+}
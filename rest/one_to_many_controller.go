@@ -1,14 +1,14 @@
 package rest
 
 import (
+	"database/sql"
 	"net/http"
+	"time"
 
 	"github.com/go-carrot/response"
 	"github.com/go-carrot/surf"
 	"github.com/go-carrot/turf"
 	"github.com/go-carrot/validator"
-	"github.com/julienschmidt/httprouter"
-	"gopkg.in/guregu/null.v3"
 )
 
 type OneToManyController struct {
@@ -18,48 +18,89 @@ type OneToManyController struct {
 	BelongsTo              func(baseModel, nestedModel surf.Model) bool
 	LifecycleHooks         LifecycleHooks
 	MethodWhiteList        []string
+	FullReplace            bool
+	FilterWhiteList        []string
+	DisableFilters         bool
+	CursorPagination       bool
+	TotalCount             bool
+	Includes               []Includable
+	BaseModelFields        ModelFields
+	NestedModelFields      ModelFields
+	DeletePolicies         []DeletePolicy
+	Database               *sql.DB
+	SoftDelete             bool
+	CanIncludeDeleted      func(r *http.Request) bool
 }
 
-func (c OneToManyController) Register(r *httprouter.Router, mw turf.Middleware) {
+func (c OneToManyController) Register(r turf.Router, mw turf.Middleware) {
 	baseModelTableName := c.GetBaseModel().GetConfiguration().TableName
 	nestedModelTableName := c.GetNestedModel().GetConfiguration().TableName
 	hasWhitelist := len(c.MethodWhiteList) != 0
+	validateDeletePolicies(nestedModelTableName, c.DeletePolicies, c.Database)
 
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.CREATE) {
-		r.HandlerFunc(
+		turf.Handle(
+			r,
+			turf.CREATE,
 			http.MethodPost,
 			"/"+baseModelTableName+"/:id/"+nestedModelTableName,
 			mw(c.Create),
 		)
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.INDEX) {
-		r.HandlerFunc(
+		turf.Handle(
+			r,
+			turf.INDEX,
 			http.MethodGet,
 			"/"+baseModelTableName+"/:id/"+nestedModelTableName,
 			mw(c.Index),
 		)
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.SHOW) {
-		r.HandlerFunc(
+		turf.Handle(
+			r,
+			turf.SHOW,
 			http.MethodGet,
 			"/"+baseModelTableName+"/:id/"+nestedModelTableName+"/:nested_id",
 			mw(c.Show),
 		)
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.UPDATE) {
-		r.HandlerFunc(
+		turf.Handle(
+			r,
+			turf.UPDATE,
 			http.MethodPut,
 			"/"+baseModelTableName+"/:id/"+nestedModelTableName+"/:nested_id",
 			mw(c.Update),
 		)
 	}
+	if !hasWhitelist || contains(c.MethodWhiteList, turf.PATCH) {
+		turf.Handle(
+			r,
+			turf.PATCH,
+			http.MethodPatch,
+			"/"+baseModelTableName+"/:id/"+nestedModelTableName+"/:nested_id",
+			mw(c.Patch),
+		)
+	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.DELETE) {
-		r.HandlerFunc(
+		turf.Handle(
+			r,
+			turf.DELETE,
 			http.MethodDelete,
 			"/"+baseModelTableName+"/:id/"+nestedModelTableName+"/:nested_id",
 			mw(c.Delete),
 		)
 	}
+	if c.SoftDelete && (!hasWhitelist || contains(c.MethodWhiteList, turf.RESTORE)) {
+		turf.Handle(
+			r,
+			turf.RESTORE,
+			http.MethodPost,
+			"/"+baseModelTableName+"/:id/"+nestedModelTableName+"/:nested_id/restore",
+			mw(c.Restore),
+		)
+	}
 }
 
 func (c OneToManyController) Create(w http.ResponseWriter, r *http.Request) {
@@ -70,12 +111,17 @@ func (c OneToManyController) Create(w http.ResponseWriter, r *http.Request) {
 	model := c.GetNestedModel()
 
 	// Generate values to be tested
-	values := getInsertValues(r, model, c.NestedForeignReference)
-	var foreignID int64
-	values = append(values, baseModelIdValue(&foreignID, r))
+	values, err := getInsertValues(r, model, c.NestedForeignReference)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(bodyErrorStatus(err), nil)
+		return
+	}
+	baseModel := c.GetBaseModel()
+	values = append(values, baseModelIdValue(baseModel, c.BaseModelFields, r))
 
 	// Test values
-	err := validator.Validate(values)
+	err = validator.Validate(values)
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
 		resp.SetResult(http.StatusBadRequest, nil)
@@ -83,18 +129,12 @@ func (c OneToManyController) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set nested reference
-	for _, field := range model.GetConfiguration().Fields {
-		if field.Name == c.NestedForeignReference {
-			switch v := field.Pointer.(type) {
-			case *null.Int:
-				v.Int64 = foreignID
-				v.Valid = true
-				break
-			case *int64:
-				*v = foreignID
-				break
-			}
-		}
+	foreignId, _ := fieldValue(baseModel, c.BaseModelFields.idField())
+	err = setFieldValue(model, c.NestedForeignReference, foreignId)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
 
 	// Before Create hook
@@ -132,13 +172,17 @@ func (c OneToManyController) Index(w http.ResponseWriter, r *http.Request) {
 	bulkFetchConfig := surf.BulkFetchConfig{}
 
 	// Validate Params
-	var id int64
-	var sort string
+	baseModel := c.GetBaseModel()
+	var sort, fields, include string
+	var includeDeleted bool
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
+		baseModelIdValue(baseModel, c.BaseModelFields, r),
 		defaultLimitValue(&bulkFetchConfig.Limit, r),
 		defaultOffsetValue(&bulkFetchConfig.Offset, r),
-		defaultSortValue(&sort, c.GetNestedModel().GetConfiguration(), r),
+		defaultSortValue(&sort, c.GetNestedModel().GetConfiguration(), c.NestedModelFields, r),
+		fieldsValue(&fields, c.GetNestedModel().GetConfiguration().TableName, c.GetNestedModel(), r),
+		includeValue(&include, c.Includes, r),
+		includeDeletedValue(&includeDeleted, c.CanIncludeDeleted, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -146,14 +190,20 @@ func (c OneToManyController) Index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Load Base Model
-	baseModel := c.GetBaseModel()
-	for _, field := range baseModel.GetConfiguration().Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
+	includes := requestedIncludes(include, c.Includes)
+
+	// Parse cursor
+	var requestCursor *cursor
+	if c.CursorPagination {
+		requestCursor, err = parseCursor(r, c.GetNestedModel().GetConfiguration(), c.NestedModelFields.idField(), sort)
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusBadRequest, nil)
+			return
 		}
 	}
+
+	// Load Base Model
 	err = baseModel.Load()
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
@@ -163,17 +213,30 @@ func (c OneToManyController) Index(w http.ResponseWriter, r *http.Request) {
 	// Consume sort query
 	bulkFetchConfig.ConsumeSortQuery(sort)
 
+	// Consume filter query
+	filterPredicates, err := getFilterPredicates(r, c.GetNestedModel(), c.FilterWhiteList, c.DisableFilters)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusBadRequest, nil)
+		return
+	}
+	bulkFetchConfig.Predicates = append(bulkFetchConfig.Predicates, filterPredicates...)
+
+	// Exclude soft deleted models
+	if c.SoftDelete && !includeDeleted {
+		bulkFetchConfig.Predicates = append(bulkFetchConfig.Predicates, notDeletedPredicate(c.NestedModelFields))
+	}
+
 	// Consume If-Modified-Since header
-	applyModSinceHeader(&bulkFetchConfig, r)
+	applyModSinceHeader(&bulkFetchConfig, c.NestedModelFields, r)
 
 	// Set where predicate
-	bulkFetchConfig.Predicates = []surf.Predicate{
-		surf.Predicate{
-			Field:         c.NestedForeignReference,
-			PredicateType: surf.WHERE_EQUAL,
-			Values:        []interface{}{id},
-		},
-	}
+	baseModelId, _ := fieldValue(baseModel, c.BaseModelFields.idField())
+	bulkFetchConfig.Predicates = append(bulkFetchConfig.Predicates, surf.Predicate{
+		Field:         c.NestedForeignReference,
+		PredicateType: surf.WHERE_EQUAL,
+		Values:        []interface{}{baseModelId},
+	})
 
 	// Before Index hook
 	if c.LifecycleHooks.BeforeIndex != nil {
@@ -184,13 +247,37 @@ func (c OneToManyController) Index(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch the models
-	models, err := c.GetNestedModel().BulkFetch(bulkFetchConfig, c.GetNestedModel)
+	var models []surf.Model
+	buildModel := selectingModel(c.GetNestedModel, c.NestedModelFields.idField(), splitFields(fields), bulkFetchConfig, append(includeFields(includes), c.NestedForeignReference, c.NestedModelFields.modifiedAtField())...)
+	if c.CursorPagination {
+		models, err = fetchCursorPage(w, r, buildModel, c.NestedModelFields.idField(), bulkFetchConfig, requestCursor, sort)
+	} else {
+		models, err = buildModel().BulkFetch(bulkFetchConfig, buildModel)
+	}
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
 		resp.SetResult(http.StatusInternalServerError, nil)
 		return
 	}
 
+	// Set Last-Modified header
+	setLastModifiedHeader(w, c.NestedModelFields, models...)
+
+	// Set pagination headers
+	total := int64(-1)
+	if c.TotalCount {
+		total, err = countModels(c.GetNestedModel(), bulkFetchConfig, c.Database)
+		if err != nil {
+			resp.SetErrorDetails(err.Error())
+			resp.SetResult(http.StatusInternalServerError, nil)
+			return
+		}
+		setTotalCountHeader(w, total)
+	}
+	if !c.CursorPagination {
+		setOffsetLinkHeader(w, r, bulkFetchConfig, sort, len(models), total)
+	}
+
 	// After Index hook
 	if c.LifecycleHooks.AfterIndex != nil {
 		err := c.LifecycleHooks.AfterIndex(resp, r, &models)
@@ -199,8 +286,24 @@ func (c OneToManyController) Index(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Select fields
+	output, err := sparseModels(models, splitFields(fields))
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Embed includes
+	output, err = embedIncludes(models, output, splitFields(fields), includes)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
 	// OK
-	resp.SetResult(http.StatusOK, models)
+	resp.SetResult(http.StatusOK, output)
 }
 
 func (c OneToManyController) Show(w http.ResponseWriter, r *http.Request) {
@@ -208,10 +311,16 @@ func (c OneToManyController) Show(w http.ResponseWriter, r *http.Request) {
 	defer resp.Output()
 
 	// Validate Params
-	var id, nestedId int64
+	baseModel := c.GetBaseModel()
+	nestedModel := c.GetNestedModel()
+	var fields, include string
+	var includeDeleted bool
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
-		nestedModelIdValue(&nestedId, r),
+		baseModelIdValue(baseModel, c.BaseModelFields, r),
+		nestedModelIdValue(nestedModel, c.NestedModelFields, r),
+		fieldsValue(&fields, c.GetNestedModel().GetConfiguration().TableName, c.GetNestedModel(), r),
+		includeValue(&include, c.Includes, r),
+		includeDeletedValue(&includeDeleted, c.CanIncludeDeleted, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -220,28 +329,12 @@ func (c OneToManyController) Show(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Load Base Model
-	baseModel := c.GetBaseModel()
-	for _, field := range baseModel.GetConfiguration().Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
-		}
-	}
 	err = baseModel.Load()
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
 
-	// Set ID
-	nestedModel := c.GetNestedModel()
-	for _, field := range nestedModel.GetConfiguration().Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = nestedId
-			break
-		}
-	}
-
 	// Before Show hook
 	if c.LifecycleHooks.BeforeShow != nil {
 		err := c.LifecycleHooks.BeforeShow(resp, r, nestedModel)
@@ -251,7 +344,7 @@ func (c OneToManyController) Show(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Load
-	err = nestedModel.Load()
+	err = loadModel(r, nestedModel, c.NestedModelFields, c.SoftDelete && !includeDeleted)
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
@@ -271,19 +364,72 @@ func (c OneToManyController) Show(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Check `If-None-Match` header
+	etag, err := modelETag(nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if !isNoneMatchHeader(etag, r) {
+		resp.SetResult(http.StatusNotModified, nil)
+		return
+	}
+
+	// Check `If-Modified-Since` header
+	setLastModifiedHeader(w, c.NestedModelFields, nestedModel)
+	if !isModifiedSinceHeader(nestedModel, c.NestedModelFields, r) {
+		resp.SetResult(http.StatusNotModified, nil)
+		return
+	}
+
+	// Select fields
+	output, err := sparseModel(nestedModel, splitFields(fields))
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Embed includes
+	output, err = embedModelIncludes(nestedModel, output, splitFields(fields), requestedIncludes(include, c.Includes))
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
 	// OK
-	resp.SetResult(http.StatusOK, nestedModel)
+	resp.SetResult(http.StatusOK, output)
 }
 
 func (c OneToManyController) Update(w http.ResponseWriter, r *http.Request) {
+	if c.FullReplace {
+		c.update(w, r, getReplaceValues)
+	} else {
+		c.update(w, r, getUpdateValues)
+	}
+}
+
+func (c OneToManyController) Patch(w http.ResponseWriter, r *http.Request) {
+	if !isPatchRequest(r) {
+		writeUnsupportedPatchType(w)
+		return
+	}
+	c.update(w, r, getPatchValues)
+}
+
+func (c OneToManyController) update(w http.ResponseWriter, r *http.Request, getValues valuesGenerator) {
 	resp := response.New(w)
 	defer resp.Output()
 
 	// Validate Params
-	var id, nestedId int64
+	baseModel := c.GetBaseModel()
+	nestedModel := c.GetNestedModel()
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
-		nestedModelIdValue(&nestedId, r),
+		baseModelIdValue(baseModel, c.BaseModelFields, r),
+		nestedModelIdValue(nestedModel, c.NestedModelFields, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -291,29 +437,24 @@ func (c OneToManyController) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Load Base Model
-	baseModel := c.GetBaseModel()
-	for _, field := range baseModel.GetConfiguration().Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
-		}
+	// Begin transaction
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
-	err = baseModel.Load()
+	defer rollbackTx(r)
+
+	// Load Base Model
+	err = loadModel(r, baseModel, c.BaseModelFields, false)
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
 
-	// Load Nested Model
-	nestedModel := c.GetNestedModel()
-	for _, field := range nestedModel.GetConfiguration().Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = nestedId
-			break
-		}
-	}
-	err = nestedModel.Load()
+	// Load Nested Model, locking it so the `If-Match` condition holds until it is updated
+	err = loadModel(r, nestedModel, c.NestedModelFields, c.SoftDelete)
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
@@ -326,14 +467,32 @@ func (c OneToManyController) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check `If-Unmodified-Since` header
-	if !isUnmodifiedSinceHeader(nestedModel, r) {
+	if !isUnmodifiedSinceHeader(nestedModel, c.NestedModelFields, r) {
 		resp.SetErrorDetails("The `If-Unmodified-Since` condition is not satisfied")
 		resp.SetResult(http.StatusPreconditionFailed, nil)
 		return
 	}
 
+	// Check `If-Match` and `If-None-Match` headers
+	etag, err := modelETag(nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if !isMatchHeader(etag, r) || !isNoneMatchHeader(etag, r) {
+		resp.SetErrorDetails("The `If-Match` or `If-None-Match` condition is not satisfied")
+		resp.SetResult(http.StatusPreconditionFailed, nil)
+		return
+	}
+
 	// Generate + test values
-	values := getUpdateValues(r, nestedModel, c.NestedForeignReference)
+	values, err := getValues(r, nestedModel, c.NestedForeignReference)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(bodyErrorStatus(err), nil)
+		return
+	}
 	err = validator.Validate(values)
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -350,7 +509,7 @@ func (c OneToManyController) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update
-	err = nestedModel.Update()
+	err = updateModel(r, nestedModel, c.NestedModelFields)
 	if err != nil {
 		handleInsertUpdateError(resp, err)
 		return
@@ -364,6 +523,23 @@ func (c OneToManyController) Update(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Commit
+	err = commitTx(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Set ETag header
+	etag, err = modelETag(nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	w.Header().Set("ETag", etag)
+
 	// OK
 	resp.SetResult(http.StatusOK, nestedModel)
 }
@@ -373,10 +549,11 @@ func (c OneToManyController) Delete(w http.ResponseWriter, r *http.Request) {
 	defer resp.Output()
 
 	// Validate Params
-	var id, nestedId int64
+	baseModel := c.GetBaseModel()
+	nestedModel := c.GetNestedModel()
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
-		nestedModelIdValue(&nestedId, r),
+		baseModelIdValue(baseModel, c.BaseModelFields, r),
+		nestedModelIdValue(nestedModel, c.NestedModelFields, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -384,29 +561,24 @@ func (c OneToManyController) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Load Base Model
-	baseModel := c.GetBaseModel()
-	for _, field := range baseModel.GetConfiguration().Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
-		}
+	// Begin transaction
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
-	err = baseModel.Load()
+	defer rollbackTx(r)
+
+	// Load Base Model
+	err = loadModel(r, baseModel, c.BaseModelFields, false)
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
 
 	// Load Nested Model
-	nestedModel := c.GetNestedModel()
-	for _, field := range nestedModel.GetConfiguration().Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = nestedId
-			break
-		}
-	}
-	err = nestedModel.Load()
+	err = loadModel(r, nestedModel, c.NestedModelFields, c.SoftDelete)
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
@@ -418,6 +590,19 @@ func (c OneToManyController) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check `If-Match` and `If-None-Match` headers
+	etag, err := modelETag(nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if !isMatchHeader(etag, r) || !isNoneMatchHeader(etag, r) {
+		resp.SetErrorDetails("The `If-Match` or `If-None-Match` condition is not satisfied")
+		resp.SetResult(http.StatusPreconditionFailed, nil)
+		return
+	}
+
 	// Before Delete hook
 	if c.LifecycleHooks.BeforeDelete != nil {
 		err := c.LifecycleHooks.BeforeDelete(resp, r, nestedModel)
@@ -426,11 +611,25 @@ func (c OneToManyController) Delete(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Apply delete policies
+	var deletedAt time.Time
+	if c.SoftDelete {
+		deletedAt = time.Now()
+	}
+	err = applyDeletePolicies(r, nestedModel, c.NestedModelFields.idField(), c.DeletePolicies, deletedAt)
+	if err != nil {
+		handleDeleteError(resp, err)
+		return
+	}
+
 	// Delete
-	err = nestedModel.Delete()
+	if c.SoftDelete {
+		err = softDeleteModel(r, nestedModel, c.NestedModelFields, deletedAt)
+	} else {
+		err = deleteModel(r, nestedModel, c.NestedModelFields)
+	}
 	if err != nil {
-		resp.SetErrorDetails(err.Error())
-		resp.SetResult(http.StatusInternalServerError, nil)
+		handleDeleteError(resp, err)
 		return
 	}
 
@@ -442,6 +641,152 @@ func (c OneToManyController) Delete(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Commit
+	err = commitTx(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
 	// OK
 	resp.SetResult(http.StatusOK, nil)
 }
+
+func (c OneToManyController) Restore(w http.ResponseWriter, r *http.Request) {
+	resp := response.New(w)
+	defer resp.Output()
+
+	// Validate Params
+	baseModel := c.GetBaseModel()
+	nestedModel := c.GetNestedModel()
+	err := validator.Validate([]*validator.Value{
+		baseModelIdValue(baseModel, c.BaseModelFields, r),
+		nestedModelIdValue(nestedModel, c.NestedModelFields, r),
+	})
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusBadRequest, nil)
+		return
+	}
+
+	// Begin transaction
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	defer rollbackTx(r)
+
+	// Load Base Model
+	err = loadModel(r, baseModel, c.BaseModelFields, false)
+	if err != nil {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Load Nested Model
+	err = loadModel(r, nestedModel, c.NestedModelFields, false)
+	if err != nil {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Verify ownership
+	if !c.BelongsTo(baseModel, nestedModel) {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Before Restore hook
+	if c.LifecycleHooks.BeforeRestore != nil {
+		err := c.LifecycleHooks.BeforeRestore(resp, r, nestedModel)
+		if err != nil {
+			return
+		}
+	}
+
+	// Restore the children deleted along with the model
+	err = restoreDeletePolicies(r, nestedModel, c.NestedModelFields.idField(), c.DeletePolicies, modelDeletedAt(nestedModel, c.NestedModelFields))
+	if err != nil {
+		handleInsertUpdateError(resp, err)
+		return
+	}
+
+	// Restore
+	err = restoreModel(r, nestedModel, c.NestedModelFields)
+	if err != nil {
+		handleInsertUpdateError(resp, err)
+		return
+	}
+
+	// After Restore hook
+	if c.LifecycleHooks.AfterRestore != nil {
+		err := c.LifecycleHooks.AfterRestore(resp, r, nestedModel)
+		if err != nil {
+			return
+		}
+	}
+
+	// Commit
+	err = commitTx(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// OK
+	resp.SetResult(http.StatusOK, nestedModel)
+}
+
+// OnDelete returns a delete policy for the nested models of this controller, to be
+// applied when their base model is deleted
+func (c OneToManyController) OnDelete(action string) DeletePolicy {
+	return DeletePolicy{
+		GetModel:         c.GetNestedModel,
+		ForeignReference: c.NestedForeignReference,
+		Action:           action,
+		ModelFields:      c.NestedModelFields,
+		DeletePolicies:   c.DeletePolicies,
+	}
+}
+
+func (c OneToManyController) IncludeName() string {
+	return c.GetNestedModel().GetConfiguration().TableName
+}
+
+func (c OneToManyController) IncludeFields() []string {
+	return []string{c.BaseModelFields.idField()}
+}
+
+func (c OneToManyController) LoadIncludes(baseModels []surf.Model) ([]interface{}, error) {
+	// Load every nested model that belongs to one of the base models, leaving out
+	// soft deleted ones
+	var predicates []surf.Predicate
+	if c.SoftDelete {
+		predicates = append(predicates, notDeletedPredicate(c.NestedModelFields))
+	}
+	nestedModels, err := fetchByField(c.GetNestedModel, c.NestedForeignReference, uniqueFieldValues(baseModels, c.BaseModelFields.idField()), predicates...)
+	if err != nil {
+		return nil, err
+	}
+	nestedModelsByForeignId := map[string][]surf.Model{}
+	for _, nestedModel := range nestedModels {
+		foreignId, _ := fieldKey(nestedModel, c.NestedForeignReference)
+		nestedModelsByForeignId[foreignId] = append(nestedModelsByForeignId[foreignId], nestedModel)
+	}
+
+	// Match each base model to its nested models
+	included := make([]interface{}, len(baseModels))
+	for i, baseModel := range baseModels {
+		id, _ := fieldKey(baseModel, c.BaseModelFields.idField())
+		if nestedModels, found := nestedModelsByForeignId[id]; found {
+			included[i] = nestedModels
+		} else {
+			included[i] = []surf.Model{}
+		}
+	}
+	return included, nil
+}
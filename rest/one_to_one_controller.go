@@ -1,14 +1,15 @@
 package rest
 
 import (
+	"database/sql"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-carrot/response"
 	"github.com/go-carrot/surf"
 	"github.com/go-carrot/turf"
 	"github.com/go-carrot/validator"
-	"github.com/julienschmidt/httprouter"
-	"gopkg.in/guregu/null.v3"
 )
 
 type OneToOneController struct {
@@ -18,24 +19,47 @@ type OneToOneController struct {
 	GetNestedModel          surf.BuildModel
 	LifecycleHooks          LifecycleHooks
 	MethodWhiteList         []string
+	FullReplace             bool
+	BaseModelFields         ModelFields
+	NestedModelFields       ModelFields
+	AttachExisting          bool
+	Upsert                  bool
+	Database                *sql.DB
+	SoftDelete              bool
+	CanIncludeDeleted       func(r *http.Request) bool
 }
 
-func (c OneToOneController) Register(r *httprouter.Router, mw turf.Middleware) {
+func (c OneToOneController) Register(r turf.Router, mw turf.Middleware) {
 	baseModelName := c.GetBaseModel().GetConfiguration().TableName
 	nestedModelName := c.NestedModelNameSingular
 	hasWhitelist := len(c.MethodWhiteList) != 0
+	if c.Upsert && c.Database == nil {
+		panic("rest: the '" + nestedModelName + "' controller must have a Database to lock the base model of an Upsert")
+	}
+	if c.AttachExisting && c.Database == nil {
+		panic("rest: the '" + nestedModelName + "' controller must have a Database to lock the models it attaches")
+	}
 
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.CREATE) {
-		r.HandlerFunc(http.MethodPost, "/"+baseModelName+"/:id/"+nestedModelName, mw(c.Create))
+		turf.Handle(r, turf.CREATE, http.MethodPost, "/"+baseModelName+"/:id/"+nestedModelName, mw(c.Create))
+	}
+	if c.AttachExisting && (!hasWhitelist || contains(c.MethodWhiteList, turf.ATTACH)) {
+		turf.Handle(r, turf.ATTACH, http.MethodPost, "/"+baseModelName+"/:id/"+nestedModelName+"/attach", mw(c.Attach))
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.SHOW) {
-		r.HandlerFunc(http.MethodGet, "/"+baseModelName+"/:id/"+nestedModelName, mw(c.Show))
+		turf.Handle(r, turf.SHOW, http.MethodGet, "/"+baseModelName+"/:id/"+nestedModelName, mw(c.Show))
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.UPDATE) {
-		r.HandlerFunc(http.MethodPut, "/"+baseModelName+"/:id/"+nestedModelName, mw(c.Update))
+		turf.Handle(r, turf.UPDATE, http.MethodPut, "/"+baseModelName+"/:id/"+nestedModelName, mw(c.Update))
+	}
+	if !hasWhitelist || contains(c.MethodWhiteList, turf.PATCH) {
+		turf.Handle(r, turf.PATCH, http.MethodPatch, "/"+baseModelName+"/:id/"+nestedModelName, mw(c.Patch))
 	}
 	if !hasWhitelist || contains(c.MethodWhiteList, turf.DELETE) {
-		r.HandlerFunc(http.MethodDelete, "/"+baseModelName+"/:id/"+nestedModelName, mw(c.Delete))
+		turf.Handle(r, turf.DELETE, http.MethodDelete, "/"+baseModelName+"/:id/"+nestedModelName, mw(c.Delete))
+	}
+	if c.SoftDelete && (!hasWhitelist || contains(c.MethodWhiteList, turf.RESTORE)) {
+		turf.Handle(r, turf.RESTORE, http.MethodPost, "/"+baseModelName+"/:id/"+nestedModelName+"/restore", mw(c.Restore))
 	}
 }
 
@@ -43,58 +67,91 @@ func (c OneToOneController) Create(w http.ResponseWriter, r *http.Request) {
 	resp := response.New(w)
 	defer resp.Output()
 
-	// Create nested model
-	nestedModel := c.GetNestedModel()
-
-	// Generate values to be tested
-	values := getInsertValues(r, nestedModel)
-	var id int64
-	values = append(values, baseModelIdValue(&id, r))
-
-	// Test values
-	err := validator.Validate(values)
+	// Validate Params
+	model := c.GetBaseModel()
+	err := validator.Validate([]*validator.Value{
+		baseModelIdValue(model, c.BaseModelFields, r),
+	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
 		resp.SetResult(http.StatusBadRequest, nil)
 		return
 	}
 
-	// Set ID
-	model := c.GetBaseModel()
-	configuration := model.GetConfiguration()
-	for _, field := range configuration.Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
-		}
+	// Begin transaction
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
+	defer rollbackTx(r)
 
 	// Load
-	err = model.Load()
+	err = loadModel(r, model, c.BaseModelFields, false)
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
 
 	// Make sure it's not already set
-	foreignId := int64(0)
-	for _, field := range configuration.Fields {
-		if field.Name == c.ForeignReference {
-			switch v := field.Pointer.(type) {
-			case *null.Int:
-				foreignId = v.Int64
-				break
-			case *int64:
-				foreignId = *v
-				break
-			}
-		}
+	isSet, err := c.hasNestedModel(r, model)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
-	if foreignId != 0 {
+	if isSet {
 		resp.SetResult(http.StatusConflict, nil)
 		return
 	}
 
+	// Insert nested model
+	c.insert(resp, r, model, http.StatusOK)
+}
+
+// hasNestedModel returns whether the loaded base model references a nested model.
+// With SoftDelete set, a soft deleted nested model doesn't count, so it can be replaced.
+func (c OneToOneController) hasNestedModel(r *http.Request, model surf.Model) (bool, error) {
+	if !isFieldSet(model, c.ForeignReference) {
+		return false, nil
+	}
+	if !c.SoftDelete {
+		return true, nil
+	}
+	foreignId, _ := fieldValue(model, c.ForeignReference)
+	nestedModel := c.GetNestedModel()
+	err := setFieldValue(nestedModel, c.NestedModelFields.idField(), foreignId)
+	if err != nil {
+		return false, err
+	}
+	err = loadModel(r, nestedModel, c.NestedModelFields, true)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// insert creates a nested model from the body of the request, and sets it as the
+// nested model of the loaded base model
+func (c OneToOneController) insert(resp *response.Response, r *http.Request, model surf.Model, status int) {
+	// Create nested model
+	nestedModel := c.GetNestedModel()
+
+	// Generate + test values
+	values, err := getInsertValues(r, nestedModel)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(bodyErrorStatus(err), nil)
+		return
+	}
+	err = validator.Validate(values)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusBadRequest, nil)
+		return
+	}
+
 	// Before Create hook
 	if c.LifecycleHooks.BeforeCreate != nil {
 		err := c.LifecycleHooks.BeforeCreate(resp, r, nestedModel)
@@ -104,43 +161,157 @@ func (c OneToOneController) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create nested model
-	err = nestedModel.Insert()
+	err = insertModel(r, nestedModel)
 	if err != nil {
 		handleInsertUpdateError(resp, err)
 		return
 	}
 
-	// Get FK
-	nestedModelId := int64(0)
-	for _, field := range nestedModel.GetConfiguration().Fields {
-		if field.Name == "id" {
-			nestedModelId = *field.Pointer.(*int64)
-			break
+	// Set foreign reference
+	nestedModelId, _ := fieldValue(nestedModel, c.NestedModelFields.idField())
+	err = setFieldValue(model, c.ForeignReference, nestedModelId)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Update
+	err = updateModel(r, model, c.BaseModelFields)
+	if err != nil {
+		handleInsertUpdateError(resp, err)
+		return
+	}
+
+	// After Create hook
+	if c.LifecycleHooks.AfterCreate != nil {
+		err := c.LifecycleHooks.AfterCreate(resp, r, nestedModel)
+		if err != nil {
+			return
 		}
 	}
 
-	// Get foreign ID
-	for _, field := range model.GetConfiguration().Fields {
-		if field.Name == c.ForeignReference {
-			switch v := field.Pointer.(type) {
-			case *null.Int:
-				v.Int64 = nestedModelId
-				v.Valid = true
-				break
-			case *int64:
-				*v = nestedModelId
-				break
-			}
+	// Commit
+	err = commitTx(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// OK
+	resp.SetResult(status, nestedModel)
+}
+
+// Attach sets the foreign reference of the base model to an existing nested model,
+// whose id is sent in the body of the request
+func (c OneToOneController) Attach(w http.ResponseWriter, r *http.Request) {
+	resp := response.New(w)
+	defer resp.Output()
+
+	// Get inputs
+	inputs, err := getRequestInputs(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(bodyErrorStatus(err), nil)
+		return
+	}
+
+	// Validate Params
+	model := c.GetBaseModel()
+	nestedModel := c.GetNestedModel()
+	err = validator.Validate([]*validator.Value{
+		baseModelIdValue(model, c.BaseModelFields, r),
+		bodyIdValue(nestedModel, c.NestedModelFields, inputs),
+	})
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusBadRequest, nil)
+		return
+	}
+
+	// Begin transaction
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	defer rollbackTx(r)
+
+	// Load, locking the base model until the nested model is attached
+	id, _ := fieldValue(model, c.BaseModelFields.idField())
+	err = loadModel(r, model, c.BaseModelFields, false)
+	if err != nil {
+		resp.SetErrorDetails(fmt.Sprintf("%v '%v' was not found.", model.GetConfiguration().TableName, id))
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Make sure it's not already set
+	isSet, err := c.hasNestedModel(r, model)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if isSet {
+		resp.SetResult(http.StatusConflict, nil)
+		return
+	}
+
+	// Load nested model, locking it so it can't be attached to two base models at once
+	nestedModelId, _ := fieldValue(nestedModel, c.NestedModelFields.idField())
+	err = loadModel(r, nestedModel, c.NestedModelFields, c.SoftDelete)
+	if err != nil {
+		resp.SetErrorDetails(fmt.Sprintf("%v '%v' was not found.", nestedModel.GetConfiguration().TableName, nestedModelId))
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Make sure the nested model isn't attached to another base model
+	attached, err := fetchModels(r, c.GetBaseModel, surf.BulkFetchConfig{
+		Limit: 1,
+		Predicates: []surf.Predicate{{
+			Field:         c.ForeignReference,
+			PredicateType: surf.WHERE_EQUAL,
+			Values:        []interface{}{nestedModelId},
+		}},
+	})
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if len(attached) > 0 {
+		resp.SetErrorDetails(fmt.Sprintf("%v '%v' is already attached to another %v.", nestedModel.GetConfiguration().TableName, nestedModelId, model.GetConfiguration().TableName))
+		resp.SetResult(http.StatusConflict, nil)
+		return
+	}
+
+	// Before Create hook
+	if c.LifecycleHooks.BeforeCreate != nil {
+		err := c.LifecycleHooks.BeforeCreate(resp, r, nestedModel)
+		if err != nil {
+			return
 		}
 	}
 
-	// Update
-	err = model.Update()
+	// Set foreign reference
+	err = setFieldValue(model, c.ForeignReference, nestedModelId)
 	if err != nil {
+		resp.SetErrorDetails(err.Error())
 		resp.SetResult(http.StatusInternalServerError, nil)
 		return
 	}
 
+	// Update
+	err = updateModel(r, model, c.BaseModelFields)
+	if err != nil {
+		handleInsertUpdateError(resp, err)
+		return
+	}
+
 	// After Create hook
 	if c.LifecycleHooks.AfterCreate != nil {
 		err := c.LifecycleHooks.AfterCreate(resp, r, nestedModel)
@@ -149,6 +320,14 @@ func (c OneToOneController) Create(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Commit
+	err = commitTx(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
 	// OK
 	resp.SetResult(http.StatusOK, nestedModel)
 }
@@ -166,9 +345,13 @@ func (c OneToOneController) Show(w http.ResponseWriter, r *http.Request) {
 	defer resp.Output()
 
 	// Validate Params
-	var id int64
+	model := c.GetBaseModel()
+	var fields string
+	var includeDeleted bool
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
+		baseModelIdValue(model, c.BaseModelFields, r),
+		fieldsValue(&fields, c.GetNestedModel().GetConfiguration().TableName, c.GetNestedModel(), r),
+		includeDeletedValue(&includeDeleted, c.CanIncludeDeleted, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -176,16 +359,6 @@ func (c OneToOneController) Show(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set ID
-	model := c.GetBaseModel()
-	configuration := model.GetConfiguration()
-	for _, field := range configuration.Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
-		}
-	}
-
 	// Load
 	err = model.Load()
 	if err != nil {
@@ -194,32 +367,19 @@ func (c OneToOneController) Show(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get foreign ID
-	foreignId := int64(0)
-	for _, field := range configuration.Fields {
-		if field.Name == c.ForeignReference {
-			switch v := field.Pointer.(type) {
-			case *null.Int:
-				foreignId = v.Int64
-				break
-			case *int64:
-				foreignId = *v
-				break
-			}
-		}
-	}
-	if foreignId == 0 {
+	if !isFieldSet(model, c.ForeignReference) {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
+	foreignId, _ := fieldValue(model, c.ForeignReference)
 
 	// Load nested model
 	nestedModel := c.GetNestedModel()
-	nestedConfig := nestedModel.GetConfiguration()
-	for _, field := range nestedConfig.Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = foreignId
-			break
-		}
+	err = setFieldValue(nestedModel, c.NestedModelFields.idField(), foreignId)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
 
 	// Before Show hook
@@ -231,7 +391,7 @@ func (c OneToOneController) Show(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Load
-	err = nestedModel.Load()
+	err = loadModel(r, nestedModel, c.NestedModelFields, c.SoftDelete && !includeDeleted)
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
@@ -245,18 +405,64 @@ func (c OneToOneController) Show(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Check `If-None-Match` header
+	etag, err := modelETag(nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if !isNoneMatchHeader(etag, r) {
+		resp.SetResult(http.StatusNotModified, nil)
+		return
+	}
+
+	// Check `If-Modified-Since` header
+	setLastModifiedHeader(w, c.NestedModelFields, nestedModel)
+	if !isModifiedSinceHeader(nestedModel, c.NestedModelFields, r) {
+		resp.SetResult(http.StatusNotModified, nil)
+		return
+	}
+
+	// Select fields
+	output, err := sparseModel(nestedModel, splitFields(fields))
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
 	// OK
-	resp.SetResult(http.StatusOK, nestedModel)
+	resp.SetResult(http.StatusOK, output)
 }
 
 func (c OneToOneController) Update(w http.ResponseWriter, r *http.Request) {
+	if c.FullReplace {
+		c.update(w, r, getReplaceValues, c.Upsert)
+	} else {
+		c.update(w, r, getUpdateValues, c.Upsert)
+	}
+}
+
+func (c OneToOneController) Patch(w http.ResponseWriter, r *http.Request) {
+	if !isPatchRequest(r) {
+		writeUnsupportedPatchType(w)
+		return
+	}
+	c.update(w, r, getPatchValues, false)
+}
+
+// update updates the nested model.  If upsert is set, the nested model is
+// inserted if the base model doesn't have one.
+func (c OneToOneController) update(w http.ResponseWriter, r *http.Request, getValues valuesGenerator, upsert bool) {
 	resp := response.New(w)
 	defer resp.Output()
 
 	// Validate Params
-	var id int64
+	model := c.GetBaseModel()
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
+		baseModelIdValue(model, c.BaseModelFields, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -264,68 +470,80 @@ func (c OneToOneController) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set ID
-	model := c.GetBaseModel()
-	configuration := model.GetConfiguration()
-	for _, field := range configuration.Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
-		}
+	// Begin transaction
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
+	defer rollbackTx(r)
 
-	// Load
-	err = model.Load()
+	// Load, locking the base model so concurrent upserts insert a single nested model
+	err = loadModel(r, model, c.BaseModelFields, false)
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
 
 	// Get foreign ID
-	foreignId := int64(0)
-	for _, field := range configuration.Fields {
-		if field.Name == c.ForeignReference {
-			switch v := field.Pointer.(type) {
-			case *null.Int:
-				foreignId = v.Int64
-				break
-			case *int64:
-				foreignId = *v
-				break
-			}
+	if !isFieldSet(model, c.ForeignReference) {
+		if upsert {
+			c.insert(resp, r, model, http.StatusCreated)
+			return
 		}
-	}
-	if foreignId == 0 {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
+	foreignId, _ := fieldValue(model, c.ForeignReference)
 
 	// Load nested model
 	nestedModel := c.GetNestedModel()
-	nestedConfig := nestedModel.GetConfiguration()
-	for _, field := range nestedConfig.Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = foreignId
-			break
-		}
+	err = setFieldValue(nestedModel, c.NestedModelFields.idField(), foreignId)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
 
 	// Load
-	err = nestedModel.Load()
+	err = loadModel(r, nestedModel, c.NestedModelFields, c.SoftDelete)
+	if err == sql.ErrNoRows && upsert {
+		c.insert(resp, r, model, http.StatusCreated)
+		return
+	}
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
 
 	// Check `If-Unmodified-Since` header
-	if !isUnmodifiedSinceHeader(nestedModel, r) {
+	if !isUnmodifiedSinceHeader(nestedModel, c.NestedModelFields, r) {
 		resp.SetErrorDetails("The `If-Unmodified-Since` condition is not satisfied")
 		resp.SetResult(http.StatusPreconditionFailed, nil)
 		return
 	}
 
+	// Check `If-Match` and `If-None-Match` headers
+	etag, err := modelETag(nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if !isMatchHeader(etag, r) || !isNoneMatchHeader(etag, r) {
+		resp.SetErrorDetails("The `If-Match` or `If-None-Match` condition is not satisfied")
+		resp.SetResult(http.StatusPreconditionFailed, nil)
+		return
+	}
+
 	// Generate + test values
-	values := getUpdateValues(r, nestedModel)
+	values, err := getValues(r, nestedModel)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(bodyErrorStatus(err), nil)
+		return
+	}
 	err = validator.Validate(values)
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -342,7 +560,7 @@ func (c OneToOneController) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update
-	err = nestedModel.Update()
+	err = updateModel(r, nestedModel, c.NestedModelFields)
 	if err != nil {
 		handleInsertUpdateError(resp, err)
 		return
@@ -356,6 +574,23 @@ func (c OneToOneController) Update(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Set ETag header
+	etag, err = modelETag(nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	w.Header().Set("ETag", etag)
+
+	// Commit
+	err = commitTx(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
 	// OK
 	resp.SetResult(http.StatusOK, nestedModel)
 }
@@ -365,9 +600,9 @@ func (c OneToOneController) Delete(w http.ResponseWriter, r *http.Request) {
 	defer resp.Output()
 
 	// Validate Params
-	var id int64
+	model := c.GetBaseModel()
 	err := validator.Validate([]*validator.Value{
-		baseModelIdValue(&id, r),
+		baseModelIdValue(model, c.BaseModelFields, r),
 	})
 	if err != nil {
 		resp.SetErrorDetails(err.Error())
@@ -375,65 +610,70 @@ func (c OneToOneController) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set ID
-	model := c.GetBaseModel()
-	configuration := model.GetConfiguration()
-	for _, field := range configuration.Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = id
-			break
-		}
+	// Begin transaction
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
+	defer rollbackTx(r)
 
 	// Load
-	err = model.Load()
+	err = loadModel(r, model, c.BaseModelFields, false)
 	if err != nil {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
 
 	// Get foreign ID
-	foreignId := int64(0)
-	for _, field := range configuration.Fields {
-		if field.Name == c.ForeignReference {
-			switch v := field.Pointer.(type) {
-			case *null.Int:
-				// Get foreign ID to load foreign model
-				foreignId = v.Int64
-
-				break
-			default:
-				resp.SetErrorDetails(
-					model.GetConfiguration().TableName +
-						"." +
-						c.ForeignReference +
-						" is not nullable.  DELETE should not be allowed.",
-				)
-				resp.SetResult(http.StatusInternalServerError, nil)
-				return
-			}
-		}
-	}
-	if foreignId == 0 {
+	if !isFieldSet(model, c.ForeignReference) {
 		resp.SetResult(http.StatusNotFound, nil)
 		return
 	}
+	foreignId, _ := fieldValue(model, c.ForeignReference)
 
 	// Set nested model's ID
 	nestedModel := c.GetNestedModel()
-	nestedConfig := nestedModel.GetConfiguration()
-	for _, field := range nestedConfig.Fields {
-		if field.Name == "id" {
-			*field.Pointer.(*int64) = foreignId
-			break
-		}
+	err = setFieldValue(nestedModel, c.NestedModelFields.idField(), foreignId)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
 	}
 
-	// Null out foreign reference
-	for _, field := range configuration.Fields {
-		if field.Name == c.ForeignReference {
-			pointer := field.Pointer.(*null.Int)
-			pointer.Valid = false
+	// Load nested model
+	err = loadModel(r, nestedModel, c.NestedModelFields, c.SoftDelete)
+	if err != nil {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Check `If-Match` and `If-None-Match` headers
+	etag, err := modelETag(nestedModel, c.NestedModelFields)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	if !isMatchHeader(etag, r) || !isNoneMatchHeader(etag, r) {
+		resp.SetErrorDetails("The `If-Match` or `If-None-Match` condition is not satisfied")
+		resp.SetResult(http.StatusPreconditionFailed, nil)
+		return
+	}
+
+	// Null out foreign reference, unless the nested model is soft deleted
+	if !c.SoftDelete {
+		err = clearFieldValue(model, c.ForeignReference)
+		if err != nil {
+			resp.SetErrorDetails(
+				model.GetConfiguration().TableName +
+					"." +
+					c.ForeignReference +
+					" is not nullable.  DELETE should not be allowed.",
+			)
+			resp.SetResult(http.StatusInternalServerError, nil)
+			return
 		}
 	}
 
@@ -445,28 +685,167 @@ func (c OneToOneController) Delete(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Remove foreign reference
-	err = model.Update()
+	// Soft delete the model, keeping the foreign reference so it can be restored
+	if c.SoftDelete {
+		err = softDeleteModel(r, nestedModel, c.NestedModelFields, time.Now())
+		if err != nil {
+			handleDeleteError(resp, err)
+			return
+		}
+	} else {
+		// Remove foreign reference
+		err = updateModel(r, model, c.BaseModelFields)
+		if err != nil {
+			handleInsertUpdateError(resp, err)
+			return
+		}
+
+		// Delete the model
+		err = deleteModel(r, nestedModel, c.NestedModelFields)
+		if err != nil {
+			handleDeleteError(resp, err)
+			return
+		}
+	}
+
+	// After Delete hook
+	if c.LifecycleHooks.AfterDelete != nil {
+		err := c.LifecycleHooks.AfterDelete(resp, r)
+		if err != nil {
+			return
+		}
+	}
+
+	// Commit
+	err = commitTx(r)
 	if err != nil {
+		resp.SetErrorDetails(err.Error())
 		resp.SetResult(http.StatusInternalServerError, nil)
 		return
 	}
 
-	// Delete the model
-	err = nestedModel.Delete()
+	// OK
+	resp.SetResult(http.StatusOK, nil)
+}
+
+func (c OneToOneController) Restore(w http.ResponseWriter, r *http.Request) {
+	resp := response.New(w)
+	defer resp.Output()
+
+	// Validate Params
+	model := c.GetBaseModel()
+	err := validator.Validate([]*validator.Value{
+		baseModelIdValue(model, c.BaseModelFields, r),
+	})
 	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusBadRequest, nil)
+		return
+	}
+
+	// Begin transaction
+	r, err = beginTx(c.Database, r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
 		resp.SetResult(http.StatusInternalServerError, nil)
 		return
 	}
+	defer rollbackTx(r)
 
-	// After Delete hook
-	if c.LifecycleHooks.AfterDelete != nil {
-		err := c.LifecycleHooks.AfterDelete(resp, r)
+	// Load
+	err = loadModel(r, model, c.BaseModelFields, false)
+	if err != nil {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Get foreign ID
+	if !isFieldSet(model, c.ForeignReference) {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+	foreignId, _ := fieldValue(model, c.ForeignReference)
+
+	// Load nested model
+	nestedModel := c.GetNestedModel()
+	err = setFieldValue(nestedModel, c.NestedModelFields.idField(), foreignId)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+	err = loadModel(r, nestedModel, c.NestedModelFields, false)
+	if err != nil {
+		resp.SetResult(http.StatusNotFound, nil)
+		return
+	}
+
+	// Before Restore hook
+	if c.LifecycleHooks.BeforeRestore != nil {
+		err := c.LifecycleHooks.BeforeRestore(resp, r, nestedModel)
+		if err != nil {
+			return
+		}
+	}
+
+	// Restore
+	err = restoreModel(r, nestedModel, c.NestedModelFields)
+	if err != nil {
+		handleInsertUpdateError(resp, err)
+		return
+	}
+
+	// After Restore hook
+	if c.LifecycleHooks.AfterRestore != nil {
+		err := c.LifecycleHooks.AfterRestore(resp, r, nestedModel)
 		if err != nil {
 			return
 		}
 	}
 
+	// Commit
+	err = commitTx(r)
+	if err != nil {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusInternalServerError, nil)
+		return
+	}
+
 	// OK
-	resp.SetResult(http.StatusOK, nil)
+	resp.SetResult(http.StatusOK, nestedModel)
+}
+
+func (c OneToOneController) IncludeName() string {
+	return c.NestedModelNameSingular
+}
+
+func (c OneToOneController) IncludeFields() []string {
+	return []string{c.ForeignReference}
+}
+
+func (c OneToOneController) LoadIncludes(baseModels []surf.Model) ([]interface{}, error) {
+	// Load every referenced nested model, leaving out soft deleted ones
+	var predicates []surf.Predicate
+	if c.SoftDelete {
+		predicates = append(predicates, notDeletedPredicate(c.NestedModelFields))
+	}
+	nestedModels, err := fetchByField(c.GetNestedModel, c.NestedModelFields.idField(), uniqueFieldValues(baseModels, c.ForeignReference), predicates...)
+	if err != nil {
+		return nil, err
+	}
+	nestedModelsById := map[string]surf.Model{}
+	for _, nestedModel := range nestedModels {
+		id, _ := fieldKey(nestedModel, c.NestedModelFields.idField())
+		nestedModelsById[id] = nestedModel
+	}
+
+	// Match each base model to its nested model
+	included := make([]interface{}, len(baseModels))
+	for i, baseModel := range baseModels {
+		foreignId, isSet := fieldKey(baseModel, c.ForeignReference)
+		if nestedModel, found := nestedModelsById[foreignId]; isSet && found {
+			included[i] = nestedModel
+		}
+	}
+	return included, nil
 }
@@ -0,0 +1,145 @@
+package rest
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-carrot/surf"
+	"github.com/lib/pq"
+)
+
+// countModels counts every row matching the Predicates of bulkFetchConfig.  Models
+// that implement Countable count themselves, otherwise the count is built from the
+// surf configuration of the model when database is set:
+//
+//	SELECT COUNT(*) FROM posts WHERE ...
+func countModels(model surf.Model, bulkFetchConfig surf.BulkFetchConfig, database *sql.DB) (int64, error) {
+	bulkFetchConfig.Limit = 0
+	bulkFetchConfig.Offset = 0
+	bulkFetchConfig.OrderBys = nil
+	if countable, isCountable := model.(Countable); isCountable {
+		return countable.Count(bulkFetchConfig)
+	}
+	if database == nil {
+		return 0, errors.New("Model '" + model.GetConfiguration().TableName + "' must implement rest.Countable to return a total count, unless a Database is set on the controller.")
+	}
+
+	var args sqlArgs
+	query := "SELECT COUNT(*) FROM " + pq.QuoteIdentifier(model.GetConfiguration().TableName)
+	if len(bulkFetchConfig.Predicates) > 0 {
+		where, err := predicatesSQL(bulkFetchConfig.Predicates, &args)
+		if err != nil {
+			return 0, err
+		}
+		query += " WHERE " + where
+	}
+	return queryCount(database, query, args)
+}
+
+// queryCount runs a query returning a single count
+func queryCount(database *sql.DB, query string, args sqlArgs) (int64, error) {
+	var count int64
+	err := database.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+// setTotalCountHeader sets the `X-Total-Count` header
+func setTotalCountHeader(w http.ResponseWriter, total int64) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+}
+
+// setOffsetLinkHeader sets the `Link` header of an offset paginated Index.
+//
+// A total below zero means the total is unknown, in which case there is no `last`
+// link, and the `next` link is only set if the page is full.
+//
+// https://tools.ietf.org/html/rfc5988
+func setOffsetLinkHeader(w http.ResponseWriter, r *http.Request, bulkFetchConfig surf.BulkFetchConfig, sort string, count int, total int64) {
+	limit := bulkFetchConfig.Limit
+	offset := bulkFetchConfig.Offset
+	link := func(offset int) string {
+		return pageURL(r, map[string]string{
+			"limit":  strconv.Itoa(limit),
+			"offset": strconv.Itoa(offset),
+			"sort":   sort,
+		})
+	}
+
+	links := map[string]string{"first": link(0)}
+	if offset > 0 {
+		prevOffset := offset - limit
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		links["prev"] = link(prevOffset)
+	}
+	if total < 0 {
+		if count == limit {
+			links["next"] = link(offset + limit)
+		}
+	} else {
+		if int64(offset+limit) < total {
+			links["next"] = link(offset + limit)
+		}
+		lastOffset := 0
+		if total > 0 {
+			lastOffset = int((total - 1) / int64(limit) * int64(limit))
+		}
+		links["last"] = link(lastOffset)
+	}
+	setLinkHeader(w, links)
+}
+
+// setCursorLinkHeader sets the `Link` header of a cursor paginated Index
+func setCursorLinkHeader(w http.ResponseWriter, r *http.Request, bulkFetchConfig surf.BulkFetchConfig, sort string, next *cursor, prev *cursor) {
+	link := func(c *cursor) string {
+		params := map[string]string{
+			"limit":  strconv.Itoa(bulkFetchConfig.Limit),
+			"sort":   sort,
+			"offset": "",
+			"cursor": "",
+		}
+		if c != nil {
+			params["cursor"] = c.encode()
+		}
+		return pageURL(r, params)
+	}
+
+	links := map[string]string{"first": link(nil)}
+	if next != nil {
+		links["next"] = link(next)
+	}
+	if prev != nil {
+		links["prev"] = link(prev)
+	}
+	setLinkHeader(w, links)
+}
+
+// pageURL returns the URL of the request, with its query parameters replaced
+// by params.  Empty params are removed.
+func pageURL(r *http.Request, params map[string]string) string {
+	query := r.URL.Query()
+	for key, value := range params {
+		if value == "" {
+			query.Del(key)
+		} else {
+			query.Set(key, value)
+		}
+	}
+	pageURL := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return pageURL.String()
+}
+
+func setLinkHeader(w http.ResponseWriter, links map[string]string) {
+	var values []string
+	for _, rel := range []string{"first", "prev", "next", "last"} {
+		if link, hasLink := links[rel]; hasLink {
+			values = append(values, "<"+link+`>; rel="`+rel+`"`)
+		}
+	}
+	w.Header().Set("Link", strings.Join(values, ", "))
+}
@@ -0,0 +1,79 @@
+package rest
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/go-carrot/surf"
+)
+
+var linkPattern = regexp.MustCompile(`<([^>]*)>; rel="([a-z]+)"`)
+
+// linkOffsets returns the offset of each link of a Link header, by rel
+func linkOffsets(t *testing.T, header string) map[string]int {
+	t.Helper()
+	offsets := map[string]int{}
+	for _, match := range linkPattern.FindAllStringSubmatch(header, -1) {
+		link, err := url.Parse(match[1])
+		if err != nil {
+			t.Fatalf("Link %q is not a valid URL: %v", match[1], err)
+		}
+		query := link.Query()
+		if query.Get("limit") != "10" || query.Get("sort") != "-name" || query.Get("filter[name]") != "a" {
+			t.Errorf("Link %q doesn't keep the other parameters", match[1])
+		}
+		offset, err := strconv.Atoi(query.Get("offset"))
+		if err != nil {
+			t.Fatalf("Link %q has an invalid offset", match[1])
+		}
+		offsets[match[2]] = offset
+	}
+	return offsets
+}
+
+func TestSetOffsetLinkHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		offset  int
+		count   int
+		total   int64
+		offsets map[string]int
+	}{
+		// Without a total count, there is a next page while pages are full
+		{name: "full first page", offset: 0, count: 10, total: -1, offsets: map[string]int{"first": 0, "next": 10}},
+		{name: "partial first page", offset: 0, count: 5, total: -1, offsets: map[string]int{"first": 0}},
+		{name: "empty first page", offset: 0, count: 0, total: -1, offsets: map[string]int{"first": 0}},
+		{name: "full middle page", offset: 20, count: 10, total: -1, offsets: map[string]int{"first": 0, "prev": 10, "next": 30}},
+		{name: "partial last page", offset: 20, count: 3, total: -1, offsets: map[string]int{"first": 0, "prev": 10}},
+		{name: "offset within the first page", offset: 5, count: 10, total: -1, offsets: map[string]int{"first": 0, "prev": 0, "next": 15}},
+		{name: "offset of one", offset: 1, count: 10, total: -1, offsets: map[string]int{"first": 0, "prev": 0, "next": 11}},
+
+		// With a total count, the last page is known
+		{name: "no rows", offset: 0, count: 0, total: 0, offsets: map[string]int{"first": 0, "last": 0}},
+		{name: "a single row", offset: 0, count: 1, total: 1, offsets: map[string]int{"first": 0, "last": 0}},
+		{name: "exactly one page", offset: 0, count: 10, total: 10, offsets: map[string]int{"first": 0, "last": 0}},
+		{name: "one more than a page", offset: 0, count: 10, total: 11, offsets: map[string]int{"first": 0, "next": 10, "last": 10}},
+		{name: "first of three pages", offset: 0, count: 10, total: 25, offsets: map[string]int{"first": 0, "next": 10, "last": 20}},
+		{name: "middle of three pages", offset: 10, count: 10, total: 25, offsets: map[string]int{"first": 0, "prev": 0, "next": 20, "last": 20}},
+		{name: "last of three pages", offset: 20, count: 5, total: 25, offsets: map[string]int{"first": 0, "prev": 10, "last": 20}},
+		{name: "last page ending on the total", offset: 10, count: 10, total: 20, offsets: map[string]int{"first": 0, "prev": 0, "last": 10}},
+		{name: "page straddling the total", offset: 15, count: 5, total: 20, offsets: map[string]int{"first": 0, "prev": 5, "last": 10}},
+		{name: "offset past the total", offset: 30, count: 0, total: 5, offsets: map[string]int{"first": 0, "prev": 20, "last": 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/posts?limit=10&offset="+strconv.Itoa(test.offset)+"&sort=-name&"+url.QueryEscape("filter[name]")+"=a", nil)
+			w := httptest.NewRecorder()
+			setOffsetLinkHeader(w, r, surf.BulkFetchConfig{Limit: 10, Offset: test.offset}, "-name", test.count, test.total)
+			offsets := linkOffsets(t, w.Header().Get("Link"))
+			if !reflect.DeepEqual(offsets, test.offsets) {
+				t.Errorf("Link offsets are %v, expected %v", offsets, test.offsets)
+			}
+		})
+	}
+}
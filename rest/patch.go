@@ -0,0 +1,457 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-carrot/response"
+	"github.com/go-carrot/surf"
+	"github.com/go-carrot/validator"
+)
+
+const (
+	MERGE_PATCH_CONTENT_TYPE = "application/merge-patch+json"
+	JSON_PATCH_CONTENT_TYPE  = "application/json-patch+json"
+)
+
+// isPatchRequest returns whether or not the request contains a patch document this package can apply
+func isPatchRequest(r *http.Request) bool {
+	switch patchMediaType(r) {
+	case MERGE_PATCH_CONTENT_TYPE, JSON_PATCH_CONTENT_TYPE, "application/json":
+		return true
+	}
+	return false
+}
+
+func patchMediaType(r *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType
+}
+
+// writeUnsupportedPatchType responds to a PATCH request that does not contain
+// a supported patch document
+func writeUnsupportedPatchType(w http.ResponseWriter) {
+	w.Header().Set("Accept-Patch", MERGE_PATCH_CONTENT_TYPE+", "+JSON_PATCH_CONTENT_TYPE)
+	resp := response.New(w)
+	resp.SetErrorDetails("PATCH requests must have a Content-Type of '" + MERGE_PATCH_CONTENT_TYPE + "' or '" + JSON_PATCH_CONTENT_TYPE + "'")
+	resp.SetResult(http.StatusUnsupportedMediaType, nil)
+	resp.Output()
+}
+
+// getPatchValues applies the patch document in the body of the request to the
+// current state of the model, and generates values for every field the patch changed.
+//
+// `application/merge-patch+json` (and plain `application/json`) bodies are applied as a
+// JSON Merge Patch (RFC 7396), `application/json-patch+json` bodies as a JSON Patch (RFC 6902).
+func getPatchValues(r *http.Request, model surf.Model, exclusions ...string) ([]*validator.Value, error) {
+	// Build the document the patch is applied to
+	original, err := modelDocument(model)
+	if err != nil {
+		return nil, err
+	}
+	document, err := modelDocument(model)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode patch
+	body := limitBody(r)
+	var patch interface{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	err = decoder.Decode(&patch)
+	if body.tooLarge {
+		return nil, errBodyTooLarge
+	}
+	if err != nil {
+		return nil, errors.New("Request body must be a valid patch document.")
+	}
+
+	// Apply patch
+	var patched interface{}
+	if patchMediaType(r) == JSON_PATCH_CONTENT_TYPE {
+		patched, err = applyJSONPatch(document, patch)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		patched = applyMergePatch(document, patch)
+	}
+	patchedDocument, isObject := patched.(map[string]interface{})
+	if !isObject {
+		return nil, errors.New("A patch must leave the model as a JSON object.")
+	}
+
+	// Generate values for the fields that have changed
+	var values []*validator.Value
+	keys := jsonFieldKeys(model)
+	for _, field := range model.GetConfiguration().Fields {
+		key, isMarshalled := keys[field.Name]
+		if !isMarshalled {
+			continue
+		}
+		originalValue, wasSet := original[key]
+		patchedValue, isSet := patchedDocument[key]
+		if wasSet == isSet && jsonEqual(originalValue, patchedValue) {
+			continue
+		}
+		if !field.Updatable || field.SkipValidation || contains(exclusions, field.Name) {
+			return nil, fmt.Errorf("Parameter '%v' cannot be modified.", field.Name)
+		}
+
+		// Convert back to an input
+		rawValue, err := json.Marshal(patchedValue)
+		if err != nil {
+			return nil, err
+		}
+		input := jsonInput(rawValue)
+
+		// Generate value
+		values = append(values,
+			&validator.Value{
+				Result: field.Pointer,
+				Name:   field.Name,
+				Input:  input,
+				Rules:  fieldRules(field),
+			})
+	}
+	return values, nil
+}
+
+// modelDocument returns the JSON representation of a model, so patches are applied
+// to the same keys the model is output with
+func modelDocument(model surf.Model) (map[string]interface{}, error) {
+	rawValue, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decodeJSONValue(rawValue)
+	if err != nil {
+		return nil, err
+	}
+	document, isObject := value.(map[string]interface{})
+	if !isObject {
+		return nil, errors.New("A model must be marshalled as a JSON object to be patched.")
+	}
+	return document, nil
+}
+
+func decodeJSONValue(rawValue []byte) (interface{}, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(rawValue))
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	return value, err
+}
+
+// jsonEqual returns whether or not two decoded JSON values are equal.  Numbers are
+// equal if their values are, regardless of how they are written.
+//
+// https://tools.ietf.org/html/rfc6902#section-4.6
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, isNumber := b.(json.Number)
+		if !isNumber {
+			return false
+		}
+		x, isValidA := new(big.Rat).SetString(string(a))
+		y, isValidB := new(big.Rat).SetString(string(b))
+		return isValidA && isValidB && x.Cmp(y) == 0
+	case map[string]interface{}:
+		b, isObject := b.(map[string]interface{})
+		if !isObject || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, isSet := b[key]
+			if !isSet || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, isArray := b.([]interface{})
+		if !isArray || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// applyMergePatch applies a JSON Merge Patch to a document
+//
+// https://tools.ietf.org/html/rfc7396#section-2
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObject, isObject := patch.(map[string]interface{})
+	if !isObject {
+		return patch
+	}
+	targetObject, isObject := target.(map[string]interface{})
+	if !isObject {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = applyMergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+// jsonPatchOperation is a single operation of a JSON Patch
+//
+// https://tools.ietf.org/html/rfc6902#section-4
+type jsonPatchOperation struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// applyJSONPatch applies a JSON Patch to a document
+//
+// https://tools.ietf.org/html/rfc6902
+func applyJSONPatch(document, patch interface{}) (interface{}, error) {
+	operations, err := parseJSONPatch(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, operation := range operations {
+		path, err := parseJSONPointer(operation.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		switch operation.Op {
+		case "add":
+			document, err = jsonPatchAdd(document, path, operation.Value)
+		case "remove":
+			document, _, err = jsonPatchRemove(document, path)
+		case "replace":
+			document, _, err = jsonPatchRemove(document, path)
+			if err == nil {
+				document, err = jsonPatchAdd(document, path, operation.Value)
+			}
+		case "move", "copy":
+			var from []string
+			from, err = parseJSONPointer(operation.From)
+			if err != nil {
+				return nil, err
+			}
+			var value interface{}
+			if operation.Op == "move" {
+				if strings.HasPrefix(operation.Path+"/", operation.From+"/") && operation.Path != operation.From {
+					return nil, fmt.Errorf("Cannot move '%v' into one of its children.", operation.From)
+				}
+				document, value, err = jsonPatchRemove(document, from)
+			} else {
+				value, err = jsonPatchGet(document, from)
+				if err == nil {
+					value, err = copyJSONValue(value)
+				}
+			}
+			if err == nil {
+				document, err = jsonPatchAdd(document, path, value)
+			}
+		case "test":
+			var value interface{}
+			value, err = jsonPatchGet(document, path)
+			if err == nil && !jsonEqual(value, operation.Value) {
+				err = fmt.Errorf("Test failed for path '%v'.", operation.Path)
+			}
+		default:
+			err = fmt.Errorf("Unsupported patch operation '%v'.", operation.Op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return document, nil
+}
+
+func parseJSONPatch(patch interface{}) ([]jsonPatchOperation, error) {
+	rawOperations, isArray := patch.([]interface{})
+	if !isArray {
+		return nil, errors.New("A JSON Patch must be an array of operations.")
+	}
+
+	var operations []jsonPatchOperation
+	for _, rawOperation := range rawOperations {
+		object, isObject := rawOperation.(map[string]interface{})
+		if !isObject {
+			return nil, errors.New("Each JSON Patch operation must be an object.")
+		}
+		operation := jsonPatchOperation{Value: object["value"]}
+		op, opIsString := object["op"].(string)
+		path, pathIsString := object["path"].(string)
+		if !opIsString || !pathIsString {
+			return nil, errors.New("Each JSON Patch operation must contain an 'op' and a 'path'.")
+		}
+		operation.Op = op
+		operation.Path = path
+		if op == "move" || op == "copy" {
+			from, fromIsString := object["from"].(string)
+			if !fromIsString {
+				return nil, fmt.Errorf("A '%v' operation must contain a 'from'.", op)
+			}
+			operation.From = from
+		}
+		if op == "add" || op == "replace" || op == "test" {
+			if _, hasValue := object["value"]; !hasValue {
+				return nil, fmt.Errorf("A '%v' operation must contain a 'value'.", op)
+			}
+		}
+		operations = append(operations, operation)
+	}
+	return operations, nil
+}
+
+// parseJSONPointer splits a JSON Pointer into its reference tokens
+//
+// https://tools.ietf.org/html/rfc6901
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("Path '%v' is not a valid JSON Pointer.", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func jsonPatchGet(document interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := document.(type) {
+		case map[string]interface{}:
+			value, exists := container[token]
+			if !exists {
+				return nil, fmt.Errorf("Path '%v' does not exist.", token)
+			}
+			document = value
+		case []interface{}:
+			index, err := jsonPatchIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			document = container[index]
+		default:
+			return nil, fmt.Errorf("Path '%v' does not exist.", token)
+		}
+	}
+	return document, nil
+}
+
+func jsonPatchAdd(document interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return jsonPatchUpdateParent(document, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			if token == "-" {
+				return append(container, value), nil
+			}
+			index, err := jsonPatchIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		}
+		return nil, fmt.Errorf("Cannot add '%v' to a value that is not an object or array.", token)
+	})
+}
+
+func jsonPatchRemove(document interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, document, nil
+	}
+	var removed interface{}
+	document, err := jsonPatchUpdateParent(document, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			value, exists := container[token]
+			if !exists {
+				return nil, fmt.Errorf("Path '%v' does not exist.", token)
+			}
+			removed = value
+			delete(container, token)
+			return container, nil
+		case []interface{}:
+			index, err := jsonPatchIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = container[index]
+			return append(container[:index], container[index+1:]...), nil
+		}
+		return nil, fmt.Errorf("Path '%v' does not exist.", token)
+	})
+	return document, removed, err
+}
+
+// jsonPatchUpdateParent walks to the parent of the value referenced by path, and
+// replaces the parent with the result of update
+func jsonPatchUpdateParent(document interface{}, path []string, update func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(document, path[0])
+	}
+	child, err := jsonPatchGet(document, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = jsonPatchUpdateParent(child, path[1:], update)
+	if err != nil {
+		return nil, err
+	}
+	switch container := document.(type) {
+	case map[string]interface{}:
+		container[path[0]] = child
+	case []interface{}:
+		index, _ := strconv.Atoi(path[0])
+		container[index] = child
+	}
+	return document, nil
+}
+
+func jsonPatchIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("Array index '%v' is invalid.", token)
+	}
+	return index, nil
+}
+
+func copyJSONValue(value interface{}) (interface{}, error) {
+	rawValue, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONValue(rawValue)
+}
@@ -0,0 +1,308 @@
+package rest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func decodeTestJSON(t *testing.T, raw string) interface{} {
+	t.Helper()
+	value, err := decodeJSONValue([]byte(raw))
+	if err != nil {
+		t.Fatalf("Invalid test JSON %v: %v", raw, err)
+	}
+	return value
+}
+
+// https://tools.ietf.org/html/rfc6902#appendix-A
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		expected string
+		fails    bool
+	}{
+		{
+			name:     "A.1 adding an object member",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			expected: `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:     "A.2 adding an array element",
+			document: `{"foo": ["bar", "baz"]}`,
+			patch:    `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			expected: `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:     "A.3 removing an object member",
+			document: `{"baz": "qux", "foo": "bar"}`,
+			patch:    `[{"op": "remove", "path": "/baz"}]`,
+			expected: `{"foo": "bar"}`,
+		},
+		{
+			name:     "A.4 removing an array element",
+			document: `{"foo": ["bar", "qux", "baz"]}`,
+			patch:    `[{"op": "remove", "path": "/foo/1"}]`,
+			expected: `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:     "A.5 replacing a value",
+			document: `{"baz": "qux", "foo": "bar"}`,
+			patch:    `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			expected: `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:     "A.6 moving a value",
+			document: `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch:    `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			expected: `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:     "A.7 moving an array element",
+			document: `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch:    `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			expected: `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name:     "A.8 testing a value: success",
+			document: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch:    `[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+			expected: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:     "A.9 testing a value: error",
+			document: `{"baz": "qux"}`,
+			patch:    `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			fails:    true,
+		},
+		{
+			name:     "A.10 adding a nested member object",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			expected: `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:     "A.11 ignoring unrecognized elements",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			expected: `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name:     "A.12 adding to a nonexistent target",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			fails:    true,
+		},
+		{
+			name:     "A.14 ~ escape ordering",
+			document: `{"/": 9, "~1": 10}`,
+			patch:    `[{"op": "test", "path": "/~01", "value": 10}]`,
+			expected: `{"/": 9, "~1": 10}`,
+		},
+		{
+			name:     "A.15 comparing strings and numbers",
+			document: `{"/": 9, "~1": 10}`,
+			patch:    `[{"op": "test", "path": "/~01", "value": "10"}]`,
+			fails:    true,
+		},
+		{
+			name:     "A.16 adding an array value",
+			document: `{"foo": ["bar"]}`,
+			patch:    `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			expected: `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+		{
+			name:     "testing numbers by value",
+			document: `{"a": 1, "b": [10, 0.5]}`,
+			patch:    `[{"op": "test", "path": "/a", "value": 1.0}, {"op": "test", "path": "/b", "value": [1e1, 5e-1]}]`,
+			expected: `{"a": 1, "b": [10, 0.5]}`,
+		},
+		{
+			name:     "testing a different number",
+			document: `{"a": 1}`,
+			patch:    `[{"op": "test", "path": "/a", "value": 1.5}]`,
+			fails:    true,
+		},
+		{
+			name:     "testing an object with a missing member",
+			document: `{"a": {"b": null}}`,
+			patch:    `[{"op": "test", "path": "/a", "value": {}}]`,
+			fails:    true,
+		},
+		{
+			name:     "removing a missing member",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "remove", "path": "/baz"}]`,
+			fails:    true,
+		},
+		{
+			name:     "replacing a missing member",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "replace", "path": "/baz", "value": "qux"}]`,
+			fails:    true,
+		},
+		{
+			name:     "adding past the end of an array",
+			document: `{"foo": ["bar"]}`,
+			patch:    `[{"op": "add", "path": "/foo/2", "value": "qux"}]`,
+			fails:    true,
+		},
+		{
+			name:     "leading zero array index",
+			document: `{"foo": ["bar", "baz"]}`,
+			patch:    `[{"op": "remove", "path": "/foo/01"}]`,
+			fails:    true,
+		},
+		{
+			name:     "unsupported operation",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "increment", "path": "/foo"}]`,
+			fails:    true,
+		},
+		{
+			name:     "missing value",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/baz"}]`,
+			fails:    true,
+		},
+		{
+			name:     "not an array",
+			document: `{"foo": "bar"}`,
+			patch:    `{"op": "add", "path": "/baz", "value": "qux"}`,
+			fails:    true,
+		},
+		{
+			name:     "operations apply in order",
+			document: `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/baz", "value": "qux"}, {"op": "remove", "path": "/foo"}]`,
+			expected: `{"baz": "qux"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patched, err := applyJSONPatch(decodeTestJSON(t, test.document), decodeTestJSON(t, test.patch))
+			if test.fails {
+				if err == nil {
+					t.Fatalf("Expected an error, got %v", patched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expected := decodeTestJSON(t, test.expected)
+			if !reflect.DeepEqual(patched, expected) {
+				t.Errorf("Patched document is %v, expected %v", patched, expected)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatchAliasing(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		expected string
+		fails    bool
+	}{
+		{
+			name:     "changing a copied object leaves the original",
+			document: `{"a": {"b": 1}}`,
+			patch:    `[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "add", "path": "/c/d", "value": 2}]`,
+			expected: `{"a": {"b": 1}, "c": {"b": 1, "d": 2}}`,
+		},
+		{
+			name:     "changing the original leaves a copied array",
+			document: `{"a": [1, 2, 3]}`,
+			patch:    `[{"op": "copy", "from": "/a", "path": "/b"}, {"op": "remove", "path": "/a/0"}]`,
+			expected: `{"a": [2, 3], "b": [1, 2, 3]}`,
+		},
+		{
+			name:     "copying an array element into the same array",
+			document: `{"a": [{"b": 1}, {"b": 2}]}`,
+			patch:    `[{"op": "copy", "from": "/a/0", "path": "/a/-"}, {"op": "replace", "path": "/a/2/b", "value": 3}]`,
+			expected: `{"a": [{"b": 1}, {"b": 2}, {"b": 3}]}`,
+		},
+		{
+			name:     "moving to the same path",
+			document: `{"a": {"b": 1}}`,
+			patch:    `[{"op": "move", "from": "/a", "path": "/a"}]`,
+			expected: `{"a": {"b": 1}}`,
+		},
+		{
+			name:     "moving into a sibling with a shared prefix",
+			document: `{"a": 1, "ab": {}}`,
+			patch:    `[{"op": "move", "from": "/a", "path": "/ab/a"}]`,
+			expected: `{"ab": {"a": 1}}`,
+		},
+		{
+			name:     "moving into one of its children",
+			document: `{"a": {"b": {}}}`,
+			patch:    `[{"op": "move", "from": "/a", "path": "/a/b/c"}]`,
+			fails:    true,
+		},
+		{
+			name:     "moving from a missing path",
+			document: `{"a": 1}`,
+			patch:    `[{"op": "move", "from": "/b", "path": "/c"}]`,
+			fails:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patched, err := applyJSONPatch(decodeTestJSON(t, test.document), decodeTestJSON(t, test.patch))
+			if test.fails {
+				if err == nil {
+					t.Fatalf("Expected an error, got %v", patched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expected := decodeTestJSON(t, test.expected)
+			if !reflect.DeepEqual(patched, expected) {
+				t.Errorf("Patched document is %v, expected %v", patched, expected)
+			}
+		})
+	}
+}
+
+// https://tools.ietf.org/html/rfc7396#appendix-A
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		target   string
+		patch    string
+		expected string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+		{`{"a": "b"}`, `{"c": null}`, `{"a": "b"}`},
+	}
+
+	for _, test := range tests {
+		patched := applyMergePatch(decodeTestJSON(t, test.target), decodeTestJSON(t, test.patch))
+		expected := decodeTestJSON(t, test.expected)
+		if !reflect.DeepEqual(patched, expected) {
+			t.Errorf("Merging %v into %v gave %v, expected %v", test.patch, test.target, patched, expected)
+		}
+	}
+}
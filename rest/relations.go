@@ -0,0 +1,152 @@
+package rest
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/go-carrot/surf"
+	"github.com/lib/pq"
+)
+
+// Relation matches the rows of a relation table that relate models to a base model
+type Relation struct {
+	// TableName is the name of the relation table
+	TableName string
+
+	// Field is the field of the relation table that references the models
+	Field string
+
+	// Predicates match the rows of the relation table for the base model
+	Predicates []surf.Predicate
+}
+
+// relatedModel wraps a nested model of a ManyToManyController, so it only fetches
+// and counts the nested models related to a base model.
+//
+// The related models are fetched in a single query, either by a nested model that
+// implements RelatedFetchable (and RelatedCountable), or by building the query from
+// the surf configurations when a Database is available.
+type relatedModel struct {
+	surf.Model
+	BuildModel surf.BuildModel
+	IdField    string
+	Relation   Relation
+	Database   *sql.DB
+}
+
+// relatedBuildModel returns a BuildModel for models that only fetch the models related
+// through relation.  database may be nil.
+func relatedBuildModel(buildModel surf.BuildModel, idField string, relation Relation, database *sql.DB) surf.BuildModel {
+	return func() surf.Model {
+		return relatedModel{
+			Model:      buildModel(),
+			BuildModel: buildModel,
+			IdField:    idField,
+			Relation:   relation,
+			Database:   database,
+		}
+	}
+}
+
+// BulkFetch fetches the related models.  The models are built with the wrapped
+// BuildModel, so buildModel is ignored.
+func (m relatedModel) BulkFetch(bulkFetchConfig surf.BulkFetchConfig, buildModel surf.BuildModel) ([]surf.Model, error) {
+	if fetchable, isFetchable := m.Model.(RelatedFetchable); isFetchable {
+		return fetchable.BulkFetchRelated(m.Relation, bulkFetchConfig, m.BuildModel)
+	}
+	if m.Database == nil {
+		return nil, errors.New("Model '" + m.GetConfiguration().TableName + "' must implement rest.RelatedFetchable to fetch related models, unless a Database is set on the controller.")
+	}
+	return m.fetchWithSubquery(bulkFetchConfig)
+}
+
+// Count counts the related models
+func (m relatedModel) Count(bulkFetchConfig surf.BulkFetchConfig) (int64, error) {
+	if countable, isCountable := m.Model.(RelatedCountable); isCountable {
+		return countable.CountRelated(m.Relation, bulkFetchConfig)
+	}
+	if m.Database == nil {
+		return 0, errors.New("Model '" + m.GetConfiguration().TableName + "' must implement rest.RelatedCountable to return a total count, unless a Database is set on the controller.")
+	}
+	return m.countWithSubquery(bulkFetchConfig)
+}
+
+// validateRelatedFetch panics if the related models of a ManyToManyController can't be
+// fetched in a single query, so the controller fails when it is registered instead of
+// on every Index
+func validateRelatedFetch(tableName string, nestedModel surf.Model, totalCount bool, database *sql.DB) {
+	if database != nil {
+		return
+	}
+	if _, isFetchable := nestedModel.(RelatedFetchable); !isFetchable {
+		panic("rest: the '" + tableName + "' controller must have a Database, or its nested model must implement rest.RelatedFetchable")
+	}
+	if _, isCountable := nestedModel.(RelatedCountable); totalCount && !isCountable {
+		panic("rest: the '" + tableName + "' controller must have a Database, or its nested model must implement rest.RelatedCountable to return a total count")
+	}
+}
+
+// relatedWhere renders the WHERE clause matching the related models and predicates:
+//
+//	WHERE id IN (SELECT tag_id FROM post_tags WHERE post_id = $1) AND ...
+func (m relatedModel) relatedWhere(predicates []surf.Predicate, args *sqlArgs) (string, error) {
+	relationConditions, err := predicatesSQL(m.Relation.Predicates, args)
+	if err != nil {
+		return "", err
+	}
+	where := " WHERE " + pq.QuoteIdentifier(m.IdField) + " IN (SELECT " + pq.QuoteIdentifier(m.Relation.Field) +
+		" FROM " + pq.QuoteIdentifier(m.Relation.TableName)
+	if relationConditions != "" {
+		where += " WHERE " + relationConditions
+	}
+	where += ")"
+	if len(predicates) > 0 {
+		conditions, err := predicatesSQL(predicates, args)
+		if err != nil {
+			return "", err
+		}
+		where += " AND " + conditions
+	}
+	return where, nil
+}
+
+// fetchWithSubquery fetches the related models with a single query:
+//
+//	SELECT ... FROM tags WHERE id IN (SELECT tag_id FROM post_tags WHERE post_id = $1) AND ... ORDER BY ... LIMIT ... OFFSET ...
+func (m relatedModel) fetchWithSubquery(bulkFetchConfig surf.BulkFetchConfig) ([]surf.Model, error) {
+	var args sqlArgs
+	configuration := m.BuildModel().GetConfiguration()
+	where, err := m.relatedWhere(bulkFetchConfig.Predicates, &args)
+	if err != nil {
+		return nil, err
+	}
+	query := "SELECT " + columnsSQL(configuration.Fields) + " FROM " + pq.QuoteIdentifier(configuration.TableName) + where +
+		orderBysSQL(bulkFetchConfig.OrderBys) + " LIMIT " + args.add(bulkFetchConfig.Limit) + " OFFSET " + args.add(bulkFetchConfig.Offset)
+
+	// Load each model
+	rows, err := m.Database.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	models := []surf.Model{}
+	for rows.Next() {
+		model := m.BuildModel()
+		err = rows.Scan(fieldPointers(model.GetConfiguration().Fields)...)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+	return models, rows.Err()
+}
+
+// countWithSubquery counts the related models with a single query
+func (m relatedModel) countWithSubquery(bulkFetchConfig surf.BulkFetchConfig) (int64, error) {
+	var args sqlArgs
+	where, err := m.relatedWhere(bulkFetchConfig.Predicates, &args)
+	if err != nil {
+		return 0, err
+	}
+	return queryCount(m.Database, "SELECT COUNT(*) FROM "+pq.QuoteIdentifier(m.GetConfiguration().TableName)+where, args)
+}
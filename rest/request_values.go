@@ -1,6 +1,12 @@
 package rest
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 
 	"github.com/go-carrot/rules"
@@ -8,57 +14,229 @@ import (
 	"github.com/go-carrot/validator"
 )
 
-func getInsertValues(r *http.Request, model surf.Model, exclusions ...string) []*validator.Value {
+// MaxBodySize is the largest request body, in bytes, that is read.  Requests with
+// a larger body are rejected with a `413 Request Entity Too Large`.
+var MaxBodySize int64 = 32 << 20
+
+// errBodyTooLarge is returned when the body of a request is larger than MaxBodySize
+var errBodyTooLarge = errors.New("Request body is too large.")
+
+// valuesGenerator generates the values to be validated and set on a model from a request
+type valuesGenerator func(r *http.Request, model surf.Model, exclusions ...string) ([]*validator.Value, error)
+
+// requestInputs contains the raw input of each parameter sent in the body of a request,
+// keyed by the parameter name
+type requestInputs map[string]string
+
+func getInsertValues(r *http.Request, model surf.Model, exclusions ...string) ([]*validator.Value, error) {
+	// Get inputs
+	inputs, err := getRequestInputs(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get values
 	var values []*validator.Value
 	for _, field := range model.GetConfiguration().Fields {
 		if field.Insertable && !field.SkipValidation && !contains(exclusions, field.Name) {
-			// Strings must be set, use null.String if you want empty string
-			var valueRules []validator.Rule
-			switch field.Pointer.(type) {
-			case *string:
-				valueRules = []validator.Rule{rules.MinLen(1)}
-			}
-
 			// Validate values
 			values = append(values,
 				&validator.Value{
 					Result: field.Pointer,
 					Name:   field.Name,
-					Input:  r.FormValue(field.Name),
-					Rules:  valueRules,
+					Input:  inputs[field.Name],
+					Rules:  fieldRules(field),
 				})
 		}
 	}
-	return values
+	return values, nil
 }
 
-func getUpdateValues(r *http.Request, model surf.Model, exclusions ...string) []*validator.Value {
-	// Parse form
-	if r.Form == nil {
-		r.ParseMultipartForm(32 << 20)
+func getUpdateValues(r *http.Request, model surf.Model, exclusions ...string) ([]*validator.Value, error) {
+	// Get inputs
+	inputs, err := getRequestInputs(r)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get values
 	var values []*validator.Value
 	for _, field := range model.GetConfiguration().Fields {
-		_, keySet := r.Form[field.Name]
+		input, keySet := inputs[field.Name]
 		if keySet && field.Updatable && !field.SkipValidation && !contains(exclusions, field.Name) {
-			// Strings must be set, use null.String if you want empty string
-			var valueRules []validator.Rule
-			switch field.Pointer.(type) {
-			case *string:
-				valueRules = []validator.Rule{rules.MinLen(1)}
-			}
+			// Generate value
+			values = append(values,
+				&validator.Value{
+					Result: field.Pointer,
+					Name:   field.Name,
+					Input:  input,
+					Rules:  fieldRules(field),
+				})
+		}
+	}
+	return values, nil
+}
+
+// getReplaceValues is the same as getUpdateValues, but every updatable field must be
+// present in the request, as the request replaces the model entirely
+func getReplaceValues(r *http.Request, model surf.Model, exclusions ...string) ([]*validator.Value, error) {
+	// Get inputs
+	inputs, err := getRequestInputs(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get values
+	var values []*validator.Value
+	for _, field := range model.GetConfiguration().Fields {
+		if field.Updatable && !field.SkipValidation && !contains(exclusions, field.Name) {
+			input, keySet := inputs[field.Name]
 
 			// Generate value
 			values = append(values,
 				&validator.Value{
 					Result: field.Pointer,
 					Name:   field.Name,
-					Input:  r.FormValue(field.Name),
-					Rules:  valueRules,
+					Input:  input,
+					Rules:  append([]validator.Rule{isPresent(keySet)}, fieldRules(field)...),
 				})
 		}
 	}
-	return values
+	return values, nil
+}
+
+// fieldRules returns the rules that apply to every input of a field
+func fieldRules(field surf.Field) []validator.Rule {
+	// Strings must be set, use null.String if you want empty string
+	switch field.Pointer.(type) {
+	case *string:
+		return []validator.Rule{rules.MinLen(1)}
+	}
+	return nil
+}
+
+// isPresent is a rule that fails when a parameter was not sent with the request
+func isPresent(keySet bool) validator.Rule {
+	return func(name string, input string) error {
+		if !keySet {
+			return fmt.Errorf("Parameter '%v' is required.", name)
+		}
+		return nil
+	}
+}
+
+// getRequestInputs reads the inputs out of the body of a request.
+//
+// Requests with a `Content-Type` of `application/json` must contain a JSON object,
+// where each key is a parameter.  All other requests are treated as forms.
+func getRequestInputs(r *http.Request) (requestInputs, error) {
+	body := limitBody(r)
+	var inputs requestInputs
+	var err error
+	if isJSONRequest(r) {
+		inputs, err = getJSONInputs(r)
+	} else {
+		inputs = getFormInputs(r)
+	}
+	if body.tooLarge {
+		return nil, errBodyTooLarge
+	}
+	return inputs, err
+}
+
+// limitedBody is the body of a request that fails once more than MaxBodySize bytes
+// are read.  It records the failure, as parsers don't always return the read error.
+type limitedBody struct {
+	io.ReadCloser
+	tooLarge bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		b.tooLarge = true
+	}
+	return n, err
+}
+
+// limitBody limits the body of a request to MaxBodySize
+func limitBody(r *http.Request) *limitedBody {
+	body := &limitedBody{ReadCloser: http.MaxBytesReader(nil, r.Body, MaxBodySize)}
+	r.Body = body
+	return body
+}
+
+// bodyErrorStatus returns the status of a response to a request whose body couldn't
+// be read
+func bodyErrorStatus(err error) int {
+	if err == errBodyTooLarge {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func getFormInputs(r *http.Request) requestInputs {
+	// Parse form
+	if r.Form == nil {
+		r.ParseMultipartForm(32 << 20)
+	}
+
+	// Take the first value of each key, the same as `r.FormValue`
+	inputs := requestInputs{}
+	for key, formValues := range r.Form {
+		if len(formValues) > 0 {
+			inputs[key] = formValues[0]
+		} else {
+			inputs[key] = ""
+		}
+	}
+	return inputs
+}
+
+func getJSONInputs(r *http.Request) (requestInputs, error) {
+	// Decode body
+	var body map[string]json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body == nil {
+		return nil, errors.New("Request body must be a valid JSON object.")
+	}
+
+	// Convert each value into the string input the validator expects
+	inputs := requestInputs{}
+	for key, rawValue := range body {
+		inputs[key] = jsonInput(rawValue)
+	}
+	return inputs, nil
+}
+
+// jsonInput converts a raw JSON value into an input string.
+//
+// Strings are unquoted, and `null` becomes an empty input so it is treated as
+// a null value by `null.*` types.  Nested objects and arrays are passed through
+// as compact JSON so they can be stored in JSON columns.
+func jsonInput(rawValue json.RawMessage) string {
+	trimmed := bytes.TrimSpace(rawValue)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return ""
+	}
+	switch trimmed[0] {
+	case '"':
+		var s string
+		if json.Unmarshal(trimmed, &s) == nil {
+			return s
+		}
+	case '{', '[':
+		var compacted bytes.Buffer
+		if json.Compact(&compacted, trimmed) == nil {
+			return compacted.String()
+		}
+	}
+	return string(trimmed)
+}
+
+// isJSONRequest returns whether or not the body of the request is JSON
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
 }
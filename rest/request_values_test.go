@@ -0,0 +1,106 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetRequestInputsBodySize(t *testing.T) {
+	defer func(maxBodySize int64) { MaxBodySize = maxBodySize }(MaxBodySize)
+	MaxBodySize = 16
+
+	tests := []struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		{contentType: "application/json", body: `{"a": "b"}`},
+		{contentType: "application/json", body: `{"a": "bcdefghijklmnop"}`, status: http.StatusRequestEntityTooLarge},
+		{contentType: "application/json", body: `{"a": `, status: http.StatusBadRequest},
+		{contentType: "application/x-www-form-urlencoded", body: "a=b"},
+		{contentType: "application/x-www-form-urlencoded", body: "a=bcdefghijklmnop", status: http.StatusRequestEntityTooLarge},
+		{contentType: "multipart/form-data; boundary=x", body: "--x\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nb\r\n--x--\r\n", status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/posts", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		inputs, err := getRequestInputs(r)
+		if test.status == 0 {
+			if err != nil {
+				t.Errorf("Unexpected error for %q: %v", test.body, err)
+			} else if inputs["a"] != "b" {
+				t.Errorf("%q gave inputs %v", test.body, inputs)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Expected %q to fail, got %v", test.body, inputs)
+		} else if status := bodyErrorStatus(err); status != test.status {
+			t.Errorf("%q failed with status %v, expected %v", test.body, status, test.status)
+		}
+	}
+}
+
+func TestJSONInput(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{raw: `null`, expected: ""},
+		{raw: ` null `, expected: ""},
+		{raw: ``, expected: ""},
+		{raw: `"hello"`, expected: "hello"},
+		{raw: `""`, expected: ""},
+		{raw: `"null"`, expected: "null"},
+		{raw: `"a\"b\u00e9"`, expected: `a"bé`},
+		{raw: `42`, expected: "42"},
+		{raw: `-1.5e3`, expected: "-1.5e3"},
+		{raw: `true`, expected: "true"},
+		{raw: `{"a": [1, 2], "b": null}`, expected: `{"a":[1,2],"b":null}`},
+		{raw: `[ {"a": "b"} , "c" ]`, expected: `[{"a":"b"},"c"]`},
+		{raw: `{}`, expected: `{}`},
+		{raw: `[]`, expected: `[]`},
+	}
+
+	for _, test := range tests {
+		input := jsonInput(json.RawMessage(test.raw))
+		if input != test.expected {
+			t.Errorf("%q gave %q, expected %q", test.raw, input, test.expected)
+		}
+	}
+}
+
+func TestGetJSONInputs(t *testing.T) {
+	r := httptest.NewRequest("POST", "/posts", strings.NewReader(`{"title": "Hello", "subtitle": null, "metadata": {"tags": ["go"]}, "count": 3}`))
+	r.Header.Set("Content-Type", "application/json")
+	inputs, err := getRequestInputs(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := requestInputs{
+		"title":    "Hello",
+		"subtitle": "",
+		"metadata": `{"tags":["go"]}`,
+		"count":    "3",
+	}
+	if len(inputs) != len(expected) {
+		t.Errorf("Inputs are %v, expected %v", inputs, expected)
+	}
+	for key, value := range expected {
+		if input, keySet := inputs[key]; !keySet || input != value {
+			t.Errorf("Input %q is %q, expected %q", key, input, value)
+		}
+	}
+
+	for _, body := range []string{`null`, `[1, 2]`, `"a"`, `{"a": }`} {
+		r := httptest.NewRequest("POST", "/posts", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if inputs, err := getRequestInputs(r); err == nil {
+			t.Errorf("Expected %q to fail, got %v", body, inputs)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-carrot/surf"
+	"github.com/go-carrot/validator"
+)
+
+// includeDeletedValue validates the `include_deleted` parameter, which includes soft
+// deleted models in a response.  The parameter is only available when canIncludeDeleted
+// permits the request.
+func includeDeletedValue(output *bool, canIncludeDeleted func(r *http.Request) bool, r *http.Request) *validator.Value {
+	return &validator.Value{
+		Result:  output,
+		Name:    "include_deleted",
+		Input:   r.URL.Query().Get("include_deleted"),
+		Default: "false",
+		Rules:   []validator.Rule{validateIncludeDeleted(canIncludeDeleted != nil && canIncludeDeleted(r))},
+	}
+}
+
+func validateIncludeDeleted(permitted bool) func(name, input string) error {
+	return func(name string, input string) error {
+		if input != "true" {
+			return nil
+		}
+		if !permitted {
+			return fmt.Errorf("Parameter '%v' is not available.", name)
+		}
+		return nil
+	}
+}
+
+// notDeletedPredicate excludes soft deleted models from a fetch
+func notDeletedPredicate(modelFields ModelFields) surf.Predicate {
+	return surf.Predicate{
+		Field:         modelFields.deletedAtField(),
+		PredicateType: surf.WHERE_IS_NULL,
+	}
+}
+
+// softDeleteModel marks a model as deleted, by setting its deleted at field to deletedAt
+func softDeleteModel(r *http.Request, model surf.Model, modelFields ModelFields, deletedAt time.Time) error {
+	err := setFieldValue(model, modelFields.deletedAtField(), deletedAt)
+	if err != nil {
+		return err
+	}
+	return updateModel(r, model, modelFields)
+}
+
+// modelDeletedAt returns the time a model was soft deleted at, or the zero time
+func modelDeletedAt(model surf.Model, modelFields ModelFields) time.Time {
+	value, _ := fieldValue(model, modelFields.deletedAtField())
+	deletedAt, _ := value.(time.Time)
+	return deletedAt
+}
+
+// restoreModel restores a soft deleted model, by clearing its deleted at field
+func restoreModel(r *http.Request, model surf.Model, modelFields ModelFields) error {
+	err := clearFieldValue(model, modelFields.deletedAtField())
+	if err != nil {
+		return err
+	}
+	return updateModel(r, model, modelFields)
+}
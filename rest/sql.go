@@ -0,0 +1,91 @@
+package rest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-carrot/surf"
+	"github.com/lib/pq"
+)
+
+// sqlArgs collects the arguments of a query, and returns their placeholders
+type sqlArgs []interface{}
+
+func (a *sqlArgs) add(value interface{}) string {
+	*a = append(*a, value)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// predicatesSQL renders predicates as the conditions of a WHERE clause, joined by AND
+func predicatesSQL(predicates []surf.Predicate, args *sqlArgs) (string, error) {
+	conditions := make([]string, len(predicates))
+	for i, predicate := range predicates {
+		condition, err := predicateSQL(predicate, args)
+		if err != nil {
+			return "", err
+		}
+		conditions[i] = condition
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// predicateSQL renders a predicate as a SQL condition, the same way surf does
+func predicateSQL(predicate surf.Predicate, args *sqlArgs) (string, error) {
+	field := pq.QuoteIdentifier(predicate.Field)
+	switch predicate.PredicateType {
+	case surf.WHERE_IS_NULL:
+		return field + " IS NULL", nil
+	case surf.WHERE_IS_NOT_NULL:
+		return field + " IS NOT NULL", nil
+	case surf.WHERE_IN, surf.WHERE_NOT_IN:
+		if len(predicate.Values) == 0 {
+			if predicate.PredicateType == surf.WHERE_IN {
+				return "FALSE", nil
+			}
+			return "TRUE", nil
+		}
+		placeholders := make([]string, len(predicate.Values))
+		for i, value := range predicate.Values {
+			placeholders[i] = args.add(value)
+		}
+		operator := " IN "
+		if predicate.PredicateType == surf.WHERE_NOT_IN {
+			operator = " NOT IN "
+		}
+		return field + operator + "(" + strings.Join(placeholders, ", ") + ")", nil
+	}
+
+	operators := map[surf.PredicateType]string{
+		surf.WHERE_LIKE:                     " LIKE ",
+		surf.WHERE_EQUAL:                    " = ",
+		surf.WHERE_NOT_EQUAL:                " != ",
+		surf.WHERE_GREATER_THAN:             " > ",
+		surf.WHERE_GREATER_THAN_OR_EQUAL_TO: " >= ",
+		surf.WHERE_LESS_THAN:                " < ",
+		surf.WHERE_LESS_THAN_OR_EQUAL_TO:    " <= ",
+	}
+	operator, supported := operators[predicate.PredicateType]
+	if !supported {
+		return "", fmt.Errorf("Predicate type '%v' on field '%v' is not supported.", predicate.PredicateType, predicate.Field)
+	}
+	if len(predicate.Values) != 1 {
+		return "", fmt.Errorf("Predicate on field '%v' must have a single value.", predicate.Field)
+	}
+	return field + operator + args.add(predicate.Values[0]), nil
+}
+
+// orderBysSQL renders orderBys as an ORDER BY clause, or an empty string if there are none
+func orderBysSQL(orderBys []surf.OrderBy) string {
+	if len(orderBys) == 0 {
+		return ""
+	}
+	clauses := make([]string, len(orderBys))
+	for i, orderBy := range orderBys {
+		clauses[i] = pq.QuoteIdentifier(orderBy.Field) + " ASC"
+		if orderBy.Type == surf.ORDER_BY_DESC {
+			clauses[i] = pq.QuoteIdentifier(orderBy.Field) + " DESC"
+		}
+	}
+	return " ORDER BY " + strings.Join(clauses, ", ")
+}
@@ -0,0 +1,378 @@
+package rest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-carrot/surf"
+	"github.com/lib/pq"
+)
+
+type txContextKey struct{}
+
+// Tx returns the transaction a request is running within, or nil if the request
+// isn't running within a transaction.  Lifecycle hooks can use it to make their
+// own queries part of the transaction.
+func Tx(r *http.Request) *sql.Tx {
+	tx, _ := r.Context().Value(txContextKey{}).(*sql.Tx)
+	return tx
+}
+
+// beginTx begins a transaction, and returns the request with the transaction
+// available through Tx.  Returns the request unchanged if db is nil, so
+// controllers without a Database run without transactions.
+func beginTx(db *sql.DB, r *http.Request) (*http.Request, error) {
+	if db == nil {
+		return r, nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return r, err
+	}
+	return r.WithContext(context.WithValue(r.Context(), txContextKey{}, tx)), nil
+}
+
+// commitTx commits the transaction of a request, if it has one
+func commitTx(r *http.Request) error {
+	tx := Tx(r)
+	if tx == nil {
+		return nil
+	}
+	return tx.Commit()
+}
+
+// rollbackTx rolls back the transaction of a request, if it has one that
+// hasn't been committed
+func rollbackTx(r *http.Request) {
+	tx := Tx(r)
+	if tx != nil {
+		tx.Rollback()
+	}
+}
+
+// Surf models always run their queries on their own database connection, so they
+// can't take part in a transaction.  Within the transaction of a request, the
+// functions below run the queries of models on the transaction instead, building
+// them from the surf configurations the same way surf does.  Outside of a
+// transaction, they use the queries of the models.
+
+// columnsSQL renders the names of fields as a list of columns
+func columnsSQL(fields []surf.Field) string {
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = pq.QuoteIdentifier(field.Name)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// fieldPointers returns the pointers of fields, to scan the columns of a row into
+func fieldPointers(fields []surf.Field) []interface{} {
+	pointers := make([]interface{}, len(fields))
+	for i, field := range fields {
+		pointers[i] = field.Pointer
+	}
+	return pointers
+}
+
+// idPredicate matches the row of a model by its id
+func idPredicate(model surf.Model, modelFields ModelFields) surf.Predicate {
+	id, _ := fieldValue(model, modelFields.idField())
+	return surf.Predicate{
+		Field:         modelFields.idField(),
+		PredicateType: surf.WHERE_EQUAL,
+		Values:        []interface{}{id},
+	}
+}
+
+// queryModel runs a query returning the columns of a model, and scans the first row
+// into the model.  Returns sql.ErrNoRows if the query returns no rows.
+func queryModel(tx *sql.Tx, model surf.Model, query string, args sqlArgs) error {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		err = rows.Err()
+		if err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	err = rows.Scan(fieldPointers(model.GetConfiguration().Fields)...)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// queryModels runs a query returning the columns of the models built by buildModel,
+// and scans each row into a new model
+func queryModels(tx *sql.Tx, buildModel surf.BuildModel, query string, args sqlArgs) ([]surf.Model, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	models := []surf.Model{}
+	for rows.Next() {
+		model := buildModel()
+		err = rows.Scan(fieldPointers(model.GetConfiguration().Fields)...)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+	return models, rows.Err()
+}
+
+// insertModel inserts a model, and loads the columns the database set back into it:
+//
+//	INSERT INTO posts (...) VALUES (...) RETURNING ...
+func insertModel(r *http.Request, model surf.Model) error {
+	tx := Tx(r)
+	if tx == nil {
+		return model.Insert()
+	}
+
+	var args sqlArgs
+	configuration := model.GetConfiguration()
+	columns := []string{}
+	values := []string{}
+	for _, field := range configuration.Fields {
+		if field.Insertable && (field.IsSet == nil || field.IsSet(field.Pointer)) {
+			columns = append(columns, pq.QuoteIdentifier(field.Name))
+			values = append(values, args.add(field.Pointer))
+		}
+	}
+	query := "INSERT INTO " + pq.QuoteIdentifier(configuration.TableName)
+	if len(columns) == 0 {
+		query += " DEFAULT VALUES"
+	} else {
+		query += " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")"
+	}
+	return queryModel(tx, model, query+" RETURNING "+columnsSQL(configuration.Fields), args)
+}
+
+// loadModel loads a model by its id.  When excludeDeleted is set, a soft deleted
+// model isn't loaded, and sql.ErrNoRows is returned as if it didn't exist.
+//
+// Within a transaction, the row of the model is locked until the transaction ends,
+// so concurrent requests can't change it between the load and the writes that
+// depend on it:
+//
+//	SELECT ... FROM posts WHERE id = $1 FOR UPDATE
+func loadModel(r *http.Request, model surf.Model, modelFields ModelFields, excludeDeleted bool) error {
+	predicates := []surf.Predicate{idPredicate(model, modelFields)}
+	if excludeDeleted {
+		predicates = append(predicates, notDeletedPredicate(modelFields))
+	}
+
+	tx := Tx(r)
+	if tx == nil {
+		if !excludeDeleted {
+			return model.Load()
+		}
+		models, err := model.BulkFetch(surf.BulkFetchConfig{
+			Limit:      1,
+			Predicates: predicates,
+		}, func() surf.Model {
+			return model
+		})
+		if err != nil {
+			return err
+		}
+		if len(models) == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	}
+
+	var args sqlArgs
+	configuration := model.GetConfiguration()
+	where, err := predicatesSQL(predicates, &args)
+	if err != nil {
+		return err
+	}
+	return queryModel(tx, model, "SELECT "+columnsSQL(configuration.Fields)+" FROM "+pq.QuoteIdentifier(configuration.TableName)+
+		" WHERE "+where+" FOR UPDATE", args)
+}
+
+// fetchModels fetches the models matching bulkFetchConfig:
+//
+//	SELECT ... FROM posts WHERE ... ORDER BY ... LIMIT ... OFFSET ...
+func fetchModels(r *http.Request, buildModel surf.BuildModel, bulkFetchConfig surf.BulkFetchConfig) ([]surf.Model, error) {
+	tx := Tx(r)
+	if tx == nil {
+		return buildModel().BulkFetch(bulkFetchConfig, buildModel)
+	}
+
+	var args sqlArgs
+	configuration := buildModel().GetConfiguration()
+	query := "SELECT " + columnsSQL(configuration.Fields) + " FROM " + pq.QuoteIdentifier(configuration.TableName)
+	if len(bulkFetchConfig.Predicates) > 0 {
+		where, err := predicatesSQL(bulkFetchConfig.Predicates, &args)
+		if err != nil {
+			return nil, err
+		}
+		query += " WHERE " + where
+	}
+	query += orderBysSQL(bulkFetchConfig.OrderBys)
+	if bulkFetchConfig.Limit > 0 {
+		query += " LIMIT " + args.add(bulkFetchConfig.Limit)
+	}
+	if bulkFetchConfig.Offset > 0 {
+		query += " OFFSET " + args.add(bulkFetchConfig.Offset)
+	}
+	return queryModels(tx, buildModel, query, args)
+}
+
+// updateModel updates a model, incrementing its version when its ModelFields have a `Version`:
+//
+//	UPDATE posts SET ..., version = version + 1 WHERE id = $1 AND version = $2 RETURNING ...
+func updateModel(r *http.Request, model surf.Model, modelFields ModelFields) error {
+	tx := Tx(r)
+	if tx == nil {
+		if modelFields.Version == "" {
+			return model.Update()
+		}
+		versioned, isVersioned := model.(Versioned)
+		if !isVersioned {
+			return errors.New("Model '" + model.GetConfiguration().TableName + "' has a version field, and must implement rest.Versioned to be updated.")
+		}
+		return versioned.UpdateVersion()
+	}
+
+	var args sqlArgs
+	configuration := model.GetConfiguration()
+	assignments := []string{}
+	for _, field := range configuration.Fields {
+		if field.Updatable && field.Name != modelFields.Version {
+			assignments = append(assignments, pq.QuoteIdentifier(field.Name)+" = "+args.add(field.Pointer))
+		}
+	}
+	predicates := []surf.Predicate{idPredicate(model, modelFields)}
+	if modelFields.Version != "" {
+		version := pq.QuoteIdentifier(modelFields.Version)
+		assignments = append(assignments, version+" = "+version+" + 1")
+		value, _ := fieldValue(model, modelFields.Version)
+		predicates = append(predicates, surf.Predicate{
+			Field:         modelFields.Version,
+			PredicateType: surf.WHERE_EQUAL,
+			Values:        []interface{}{value},
+		})
+	}
+	if len(assignments) == 0 {
+		return nil
+	}
+	where, err := predicatesSQL(predicates, &args)
+	if err != nil {
+		return err
+	}
+	err = queryModel(tx, model, "UPDATE "+pq.QuoteIdentifier(configuration.TableName)+" SET "+strings.Join(assignments, ", ")+
+		" WHERE "+where+" RETURNING "+columnsSQL(configuration.Fields), args)
+	if err == sql.ErrNoRows && modelFields.Version != "" {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+// deleteModel deletes a model:
+//
+//	DELETE FROM posts WHERE id = $1
+func deleteModel(r *http.Request, model surf.Model, modelFields ModelFields) error {
+	tx := Tx(r)
+	if tx == nil {
+		return model.Delete()
+	}
+
+	var args sqlArgs
+	where, err := predicatesSQL([]surf.Predicate{idPredicate(model, modelFields)}, &args)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM "+pq.QuoteIdentifier(model.GetConfiguration().TableName)+" WHERE "+where, args...)
+	return err
+}
+
+// deleteModels deletes the models matching predicates in a single query.  Outside of a
+// transaction, the models must implement BulkDeletable.
+//
+//	DELETE FROM comments WHERE post_id = $1
+func deleteModels(r *http.Request, buildModel surf.BuildModel, predicates []surf.Predicate) error {
+	model := buildModel()
+	tx := Tx(r)
+	if tx == nil {
+		deletable, isDeletable := model.(BulkDeletable)
+		if !isDeletable {
+			return errors.New("Model '" + model.GetConfiguration().TableName + "' must implement rest.BulkDeletable to be deleted outside of a transaction.")
+		}
+		return deletable.BulkDelete(surf.BulkFetchConfig{Predicates: predicates})
+	}
+
+	var args sqlArgs
+	where, err := predicatesSQL(predicates, &args)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM "+pq.QuoteIdentifier(model.GetConfiguration().TableName)+" WHERE "+where, args...)
+	return err
+}
+
+// updateModels updates the models matching predicates to the updatable values of model
+// in a single query.  Outside of a transaction, the model must implement BulkUpdatable.
+//
+//	UPDATE post_tags SET ... WHERE post_id = $1 AND tag_id = $2
+func updateModels(r *http.Request, model surf.Model, predicates []surf.Predicate) error {
+	tx := Tx(r)
+	if tx == nil {
+		updatable, isUpdatable := model.(BulkUpdatable)
+		if !isUpdatable {
+			return errors.New("Model '" + model.GetConfiguration().TableName + "' must implement rest.BulkUpdatable to be updated outside of a transaction.")
+		}
+		return updatable.BulkUpdate(surf.BulkFetchConfig{Predicates: predicates})
+	}
+
+	var args sqlArgs
+	configuration := model.GetConfiguration()
+	assignments := []string{}
+	for _, field := range configuration.Fields {
+		if field.Updatable {
+			assignments = append(assignments, pq.QuoteIdentifier(field.Name)+" = "+args.add(field.Pointer))
+		}
+	}
+	if len(assignments) == 0 {
+		return nil
+	}
+	where, err := predicatesSQL(predicates, &args)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE "+pq.QuoteIdentifier(configuration.TableName)+" SET "+strings.Join(assignments, ", ")+" WHERE "+where, args...)
+	return err
+}
+
+// softDeleteModels marks the models matching predicates as deleted at deletedAt in a
+// single query.  Must run within a transaction.
+//
+//	UPDATE post_tags SET deleted_at = $1 WHERE post_id = $2 AND ...
+func softDeleteModels(r *http.Request, buildModel surf.BuildModel, modelFields ModelFields, predicates []surf.Predicate, deletedAt time.Time) error {
+	model := buildModel()
+	tx := Tx(r)
+	if tx == nil {
+		return errors.New("Model '" + model.GetConfiguration().TableName + "' can only be soft deleted in bulk within a transaction.")
+	}
+
+	var args sqlArgs
+	assignment := pq.QuoteIdentifier(modelFields.deletedAtField()) + " = " + args.add(deletedAt)
+	where, err := predicatesSQL(predicates, &args)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE "+pq.QuoteIdentifier(model.GetConfiguration().TableName)+" SET "+assignment+" WHERE "+where, args...)
+	return err
+}
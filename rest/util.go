@@ -20,6 +20,12 @@ func contains(s []string, e string) bool {
 }
 
 func handleInsertUpdateError(resp *response.Response, err error) {
+	// The model was modified by another request
+	if err == ErrVersionConflict {
+		resp.SetErrorDetails(err.Error())
+		resp.SetResult(http.StatusPreconditionFailed, nil)
+		return
+	}
 	pqErr, isPqError := err.(*pq.Error)
 	if isPqError {
 		switch pqErr.Code {
@@ -49,17 +55,33 @@ func handleInsertUpdateError(resp *response.Response, err error) {
 	return
 }
 
+func handleDeleteError(resp *response.Response, err error) {
+	// The model is still referenced
+	if restrictedErr, isRestricted := err.(deleteRestrictedError); isRestricted {
+		resp.SetErrorDetails(restrictedErr.Error())
+		resp.SetResult(http.StatusConflict, nil)
+		return
+	}
+	pqErr, isPqError := err.(*pq.Error)
+	if isPqError && pqErr.Code == POSTGRES_ERROR_FOREIGN_KEY_VIOLATION {
+		resp.SetErrorDetails(pqErr.Detail)
+		resp.SetResult(http.StatusConflict, nil)
+		return
+	}
+	resp.SetResult(http.StatusInternalServerError, nil)
+}
+
 // https://tools.ietf.org/html/rfc7232#section-3.3
 //
 // > A recipient MUST ignore the If-Modified-Since header field if the
 // > received field-value is not a valid HTTP-date...
-func applyModSinceHeader(bulkFetchConfig *surf.BulkFetchConfig, r *http.Request) {
+func applyModSinceHeader(bulkFetchConfig *surf.BulkFetchConfig, modelFields ModelFields, r *http.Request) {
 	header := r.Header["If-Modified-Since"]
 	if len(header) > 0 {
 		lastModified, err := time.Parse(time.RFC1123, header[0])
 		if err == nil {
 			bulkFetchConfig.Predicates = append(bulkFetchConfig.Predicates, surf.Predicate{
-				Field:         "modified_at",
+				Field:         modelFields.modifiedAtField(),
 				PredicateType: surf.WHERE_GREATER_THAN,
 				Values:        []interface{}{lastModified},
 			})
@@ -71,28 +93,22 @@ func applyModSinceHeader(bulkFetchConfig *surf.BulkFetchConfig, r *http.Request)
 //
 // > A recipient MUST ignore the If-Unmodified-Since header field if the
 // > received field-value is not a valid HTTP-date.
-func isUnmodifiedSinceHeader(model surf.Model, r *http.Request) bool {
+//
+// https://tools.ietf.org/html/rfc7232#section-6
+//
+// > When recipient is the origin server and If-Match is not present,
+// > evaluate the If-Unmodified-Since precondition...
+func isUnmodifiedSinceHeader(model surf.Model, modelFields ModelFields, r *http.Request) bool {
 	header := r.Header["If-Unmodified-Since"]
-	if len(header) > 0 {
+	if len(header) > 0 && len(r.Header["If-Match"]) == 0 {
 		// Parse If-Unmodified-Since to get the time.Time
 		ifUnmodifiedSince, err := time.Parse(time.RFC1123, header[0])
 		if err == nil {
 			// Figure out the time the model was actually last modified
-			var modifiedAt time.Time
-			for _, field := range model.GetConfiguration().Fields {
-				if field.Name == "modified_at" {
-					switch v := field.Pointer.(type) {
-					case *time.Time:
-						modifiedAt = *v
-					case *null.Time:
-						modifiedAt = v.Time
-					}
-					break
-				}
-			}
+			modifiedAt := modelModifiedAt(model, modelFields)
 
 			// Make sure we satisfy our `If-Unmodified-Since` condition.
-			// If no `modified_at` attribute is set on the model, there is no
+			// If no modified at attribute is set on the model, there is no
 			// way we can determine that it's not been modified, so we must return
 			// false and prevent the model from being updated.
 			//
@@ -106,6 +122,58 @@ func isUnmodifiedSinceHeader(model surf.Model, r *http.Request) bool {
 	return true
 }
 
+// https://tools.ietf.org/html/rfc7232#section-3.3
+//
+// > A recipient MUST ignore If-Modified-Since if the request contains an
+// > If-None-Match header field...
+func isModifiedSinceHeader(model surf.Model, modelFields ModelFields, r *http.Request) bool {
+	header := r.Header["If-Modified-Since"]
+	if len(header) > 0 && len(r.Header["If-None-Match"]) == 0 {
+		ifModifiedSince, err := time.Parse(time.RFC1123, header[0])
+		if err == nil {
+			// If no modified at attribute is set on the model, we can't tell that
+			// it hasn't been modified, so it must be sent again
+			modifiedAt := modelModifiedAt(model, modelFields)
+			if !modifiedAt.IsZero() && !floorNsecs(modifiedAt).After(ifModifiedSince) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// setLastModifiedHeader sets the `Last-Modified` header to the time the most
+// recently modified of models was modified
+func setLastModifiedHeader(w http.ResponseWriter, modelFields ModelFields, models ...surf.Model) {
+	var lastModified time.Time
+	for _, model := range models {
+		modifiedAt := modelModifiedAt(model, modelFields)
+		if modifiedAt.After(lastModified) {
+			lastModified = modifiedAt
+		}
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// modelModifiedAt returns the time a model was last modified, or the zero time if
+// the model doesn't have a modified at attribute
+func modelModifiedAt(model surf.Model, modelFields ModelFields) time.Time {
+	for _, field := range model.GetConfiguration().Fields {
+		if field.Name == modelFields.modifiedAtField() {
+			switch v := field.Pointer.(type) {
+			case *time.Time:
+				return *v
+			case *null.Time:
+				return v.Time
+			}
+			break
+		}
+	}
+	return time.Time{}
+}
+
 // floorNsecs
 func floorNsecs(in time.Time) time.Time {
 	return time.Date(
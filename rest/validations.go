@@ -1,37 +1,120 @@
 package rest
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/go-carrot/rules"
 	"github.com/go-carrot/surf"
+	"github.com/go-carrot/turf"
 	"github.com/go-carrot/validator"
 )
 
-func baseModelIdValue(output *int64, r *http.Request) *validator.Value {
+func baseModelIdValue(model surf.Model, modelFields ModelFields, r *http.Request) *validator.Value {
+	return idValue(model, modelFields, "id", r)
+}
+
+func nestedModelIdValue(model surf.Model, modelFields ModelFields, r *http.Request) *validator.Value {
+	return idValue(model, modelFields, "nested_id", r)
+}
+
+// idValue validates the path parameter `name`, and sets it as the id of model.
+// The parameter is parsed based on the type of the id field (int64, string, UUID, etc.)
+func idValue(model surf.Model, modelFields ModelFields, name string, r *http.Request) *validator.Value {
+	var input string
 	return &validator.Value{
-		Result: output,
-		Name:   "id",
-		Input:  strings.Split(r.URL.Path, "/")[2],
+		Result: &input,
+		Name:   name,
+		Input:  turf.Param(r, name),
 		Rules: []validator.Rule{
 			rules.IsSet,
+			setIdField(model, modelFields.idField()),
 		},
 	}
 }
 
-func nestedModelIdValue(output *int64, r *http.Request) *validator.Value {
+// bodyIdValue validates an id sent in the body of a request, and sets it as the id of model.
+// The id is sent in the parameter named after the id field.
+func bodyIdValue(model surf.Model, modelFields ModelFields, inputs requestInputs) *validator.Value {
+	var input string
 	return &validator.Value{
-		Result: output,
-		Name:   "nested_id",
-		Input:  strings.Split(r.URL.Path, "/")[4],
+		Result: &input,
+		Name:   modelFields.idField(),
+		Input:  inputs[modelFields.idField()],
 		Rules: []validator.Rule{
 			rules.IsSet,
+			setIdField(model, modelFields.idField()),
 		},
 	}
 }
 
+func setIdField(model surf.Model, idField string) func(name, input string) error {
+	return func(name string, input string) error {
+		for _, field := range model.GetConfiguration().Fields {
+			if field.Name == idField {
+				if parseFieldInput(field.Pointer, input) != nil {
+					return fmt.Errorf("Parameter '%v' is not a valid id. Input '%v' is invalid.", name, input)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("Model '%v' does not have an id field '%v'.", model.GetConfiguration().TableName, idField)
+	}
+}
+
+// nestedIdsValue validates the `ids` parameter of a request body, a list of
+// nested model ids, and sets the parsed ids in output.
+//
+// The list may be a JSON array, or a comma separated list.
+func nestedIdsValue(output *[]interface{}, buildModel surf.BuildModel, modelFields ModelFields, inputs requestInputs) *validator.Value {
+	var result string
+	input, keySet := inputs["ids"]
+	return &validator.Value{
+		Result: &result,
+		Name:   "ids",
+		Input:  input,
+		Rules: []validator.Rule{
+			isPresent(keySet),
+			setNestedIds(output, buildModel, modelFields.idField()),
+		},
+	}
+}
+
+func setNestedIds(output *[]interface{}, buildModel surf.BuildModel, idField string) func(name, input string) error {
+	return func(name string, input string) error {
+		// Split list
+		var inputIds []string
+		trimmed := strings.TrimSpace(input)
+		if strings.HasPrefix(trimmed, "[") {
+			var rawIds []json.RawMessage
+			if json.Unmarshal([]byte(trimmed), &rawIds) != nil {
+				return fmt.Errorf("Parameter '%v' must be a list of ids.", name)
+			}
+			for _, rawId := range rawIds {
+				inputIds = append(inputIds, jsonInput(rawId))
+			}
+		} else if trimmed != "" {
+			inputIds = strings.Split(trimmed, ",")
+		}
+
+		// Parse each id based on the type of the id field
+		ids := []interface{}{}
+		for _, inputId := range inputIds {
+			model := buildModel()
+			err := setIdField(model, idField)(name, strings.TrimSpace(inputId))
+			if err != nil {
+				return err
+			}
+			id, _ := fieldValue(model, idField)
+			ids = append(ids, id)
+		}
+		*output = ids
+		return nil
+	}
+}
+
 func defaultLimitValue(output *int, r *http.Request) *validator.Value {
 	return &validator.Value{
 		Result:  output,
@@ -57,13 +140,13 @@ func defaultOffsetValue(output *int, r *http.Request) *validator.Value {
 	}
 }
 
-func defaultSortValue(output *string, config *surf.Configuration, r *http.Request) *validator.Value {
+func defaultSortValue(output *string, config *surf.Configuration, modelFields ModelFields, r *http.Request) *validator.Value {
 	return &validator.Value{
 		Result:  output,
 		Name:    "sort",
 		Input:   r.URL.Query().Get("sort"),
 		Rules:   []validator.Rule{validateSortField(config)},
-		Default: "created_at",
+		Default: modelFields.createdAtField(),
 	}
 }
 
@@ -81,3 +164,37 @@ func validateSortField(config *surf.Configuration) func(name, input string) erro
 		return nil
 	}
 }
+
+func fieldsValue(output *string, resource string, model surf.Model, r *http.Request) *validator.Value {
+	// Per-resource fields take precedence
+	name := "fields[" + resource + "]"
+	input := r.URL.Query().Get(name)
+	if input == "" {
+		name = "fields"
+		input = r.URL.Query().Get(name)
+	}
+
+	return &validator.Value{
+		Result: output,
+		Name:   name,
+		Input:  input,
+		Rules:  []validator.Rule{validateFieldsField(model)},
+	}
+}
+
+// validateFieldsField only accepts fields that are part of the model's output, so
+// fields that aren't marshalled can't be selected
+func validateFieldsField(model surf.Model) func(name, input string) error {
+	return func(name string, input string) error {
+		if input == "" {
+			return nil
+		}
+		keys := jsonFieldKeys(model)
+		for _, inputField := range strings.Split(input, ",") {
+			if _, ok := keys[inputField]; !ok {
+				return fmt.Errorf("Parameter '%v' must only contain fields within the model. Input '%v' is invalid.", name, inputField)
+			}
+		}
+		return nil
+	}
+}
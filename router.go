@@ -0,0 +1,99 @@
+package turf
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type routerContextKey struct{}
+
+// Router is the interface controllers are registered to.
+//
+// Patterns are in the format `/posts/:id`, where `:id` is a path parameter.
+type Router interface {
+	// Handle registers a handler for a method + pattern
+	Handle(method string, pattern string, handler http.HandlerFunc)
+
+	// Param returns the value of a path parameter of a request handled by this Router
+	Param(r *http.Request, name string) string
+}
+
+// MethodRouter is implemented by Routers that also need to know which controller
+// method (CREATE, INDEX, etc.) a route is for, such as Group
+type MethodRouter interface {
+	Router
+	HandleMethod(controllerMethod string, method string, pattern string, handler http.HandlerFunc)
+}
+
+// Handle registers the handler of a controller method to a Router, making the Router
+// available to the handler (and any middleware wrapping it) through Param
+func Handle(router Router, controllerMethod string, method string, pattern string, handler http.HandlerFunc) {
+	handle(router, controllerMethod, method, pattern, handler)
+}
+
+// handle registers a handler through any MethodRouters (Groups) down to the Router
+// they are mounted on.  The Router is added to the request context there, outside
+// of every middleware the MethodRouters wrap the handler in.
+func handle(router Router, controllerMethod string, method string, pattern string, handler http.HandlerFunc) {
+	if methodRouter, ok := router.(MethodRouter); ok {
+		methodRouter.HandleMethod(controllerMethod, method, pattern, handler)
+		return
+	}
+	router.Handle(method, pattern, func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(context.WithValue(r.Context(), routerContextKey{}, router)))
+	})
+}
+
+// Param returns the value of a path parameter of a request handled by a
+// handler registered with Handle
+func Param(r *http.Request, name string) string {
+	router, ok := r.Context().Value(routerContextKey{}).(Router)
+	if !ok {
+		return ""
+	}
+	return router.Param(r, name)
+}
+
+// HttpRouter adapts a httprouter.Router to a Router
+func HttpRouter(router *httprouter.Router) Router {
+	return httpRouter{router}
+}
+
+type httpRouter struct {
+	router *httprouter.Router
+}
+
+func (h httpRouter) Handle(method string, pattern string, handler http.HandlerFunc) {
+	h.router.HandlerFunc(method, pattern, handler)
+}
+
+func (h httpRouter) Param(r *http.Request, name string) string {
+	return httprouter.ParamsFromContext(r.Context()).ByName(name)
+}
+
+// ServeMux adapts a http.ServeMux to a Router
+func ServeMux(mux *http.ServeMux) Router {
+	return serveMux{mux}
+}
+
+type serveMux struct {
+	mux *http.ServeMux
+}
+
+func (s serveMux) Handle(method string, pattern string, handler http.HandlerFunc) {
+	// `/posts/:id` becomes `/posts/{id}`
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	s.mux.HandleFunc(method+" "+strings.Join(segments, "/"), handler)
+}
+
+func (s serveMux) Param(r *http.Request, name string) string {
+	return r.PathValue(name)
+}